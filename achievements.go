@@ -0,0 +1,293 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/FuzzyStatic/blizzard/v3/wowp"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// statistic is a statistic as stored in the "statistics" field of "character_achievements", keyed by its id.
+type statistic struct {
+	Name     string  `json:"name"`
+	Quantity float64 `json:"quantity"`
+}
+
+func init() {
+	registerCharacterSync(characterSync{
+		name: "achievements",
+		fetch: func(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+			achievements, _, err := client.WoWCharacterAchievementsSummary(ctx, realmSlug, characterName)
+			return achievements, err
+		},
+		save: saveAchievements,
+	})
+	registerCharacterSync(characterSync{
+		name: "statistics",
+		fetch: func(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+			statistics, _, err := client.WoWCharacterAchievementsStatistics(ctx, realmSlug, characterName)
+			return statistics, err
+		},
+		save: saveStatistics,
+	})
+}
+
+// achievementProgress is a record of "character_achievement_progress".
+type achievementProgress struct {
+	ID                 string  `db:"id"`
+	AchievementID      int     `db:"achievement_id"`
+	CompletedTimestamp int64   `db:"completed_timestamp"`
+	CriteriaAmount     float64 `db:"criteria_amount"`
+	ChildCompleted     int     `db:"child_completed"`
+	ChildTotal         int     `db:"child_total"`
+}
+
+func (p achievementProgress) params() dbx.Params {
+	return dbx.Params{
+		"id":                  p.ID,
+		"achievement_id":      p.AchievementID,
+		"completed_timestamp": p.CompletedTimestamp,
+		"criteria_amount":     p.CriteriaAmount,
+		"child_completed":     p.ChildCompleted,
+		"child_total":         p.ChildTotal,
+	}
+}
+
+// saveAchievements stores the achievements of a character in "character_achievement_progress", one record per
+// achievement so only the achievements whose completion or criteria progress changed are written, and the totals
+// in "character_achievements". Achievements completed since the previous sync are added to the "guild_achievement_feed".
+func saveAchievements(app core.App, character *core.Record, data any, runID string) error {
+	summary := data.(*wowp.CharacterAchievementsSummary)
+
+	names := make(map[int]string, len(summary.Achievements))
+	completedAt := map[int]int64{}
+	progress := make(map[int]achievementProgress, len(summary.Achievements))
+	for _, a := range summary.Achievements {
+		id := cmp.Or(a.Achievement.ID, a.ID)
+		p := achievementProgress{AchievementID: id, CompletedTimestamp: a.CompleteTimestamp}
+		// the criteria progress is only kept for achievements that aren't completed yet
+		if a.CompleteTimestamp != 0 {
+			completedAt[id] = a.CompleteTimestamp
+		} else {
+			for _, child := range a.Criteria.ChildCriteria {
+				if child.IsCompleted {
+					p.ChildCompleted++
+				}
+			}
+			p.CriteriaAmount = a.Criteria.Amount
+			p.ChildTotal = len(a.Criteria.ChildCriteria)
+		}
+		names[id] = a.Achievement.Name
+		progress[id] = p
+	}
+
+	// loaded once for the diff and the feed, a character synced for the first time has nothing new
+	var previous []achievementProgress
+	err := app.DB().
+		Select("id", "achievement_id", "completed_timestamp", "criteria_amount", "child_completed", "child_total").
+		From("character_achievement_progress").
+		Where(dbx.HashExp{"character": character.Id}).
+		All(&previous)
+	if err != nil {
+		return err
+	}
+
+	// plain inserts and updates instead of app.Save, every member has a few thousand achievements
+	completed := make(map[int]struct{}, len(previous))
+	removed := []any{}
+	for _, old := range previous {
+		if old.CompletedTimestamp != 0 {
+			completed[old.AchievementID] = struct{}{}
+		}
+		current, ok := progress[old.AchievementID]
+		if !ok {
+			removed = append(removed, old.ID)
+			continue
+		}
+		delete(progress, old.AchievementID)
+		current.ID = old.ID
+		if current == old {
+			continue
+		}
+		if _, err := app.DB().Update("character_achievement_progress", current.params(), dbx.HashExp{"id": old.ID}).Execute(); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(progress)) {
+		params := progress[id].params()
+		params["id"] = core.GenerateDefaultRandomId()
+		params["character"] = character.Id
+		if _, err := app.DB().Insert("character_achievement_progress", params).Execute(); err != nil {
+			return err
+		}
+	}
+	if len(removed) > 0 {
+		if _, err := app.DB().Delete("character_achievement_progress", dbx.In("id", removed...)).Execute(); err != nil {
+			return err
+		}
+	}
+
+	err = syncCharacterRecord(app, "character_achievements", character, map[string]any{
+		"total_quantity": summary.TotalQuantity,
+		"total_points":   summary.TotalPoints,
+	})
+	if err != nil || len(previous) == 0 {
+		return err
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(completedAt)) {
+		if _, ok := completed[id]; ok {
+			continue
+		}
+		if err := saveAchievementFeed(app, character, id, completedAt[id], names[id], runID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveAchievementFeed adds a newly completed achievement of a character to the "guild_achievement_feed".
+// Account wide achievements complete on all characters of an account at once, they are added only once per guild.
+func saveAchievementFeed(app core.App, character *core.Record, id int, completedTimestamp int64, name string, runID string) error {
+	guildID := character.GetString("guild")
+	if guildID == "" {
+		return nil
+	}
+	_, err := app.FindFirstRecordByFilter(
+		"guild_achievement_feed",
+		"guild = {:guild} && achievement_id = {:achievement} && completed_timestamp = {:completed}",
+		dbx.Params{"guild": guildID, "achievement": id, "completed": completedTimestamp},
+	)
+	if err == nil {
+		return nil
+	}
+	collection, err := app.FindCollectionByNameOrId("guild_achievement_feed")
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("guild", guildID)
+	record.Set("character", character.Id)
+	record.Set("character_name", character.GetString("name"))
+	record.Set("realm", character.GetString("realm"))
+	record.Set("achievement_id", id)
+	record.Set("achievement_name", name)
+	record.Set("completed_timestamp", completedTimestamp)
+	record.Set("sync_run", runID)
+	if err := app.Save(record); err != nil {
+		return fmt.Errorf("saving feed entry of achievement %d: %w", id, err)
+	}
+	return nil
+}
+
+// defaultStatistics are stored if ACHIEVEMENT_STATISTICS is unset: total deaths, daily quests and quests completed,
+// gold acquired, flight paths taken, hearthstone uses, honorable kills, battlegrounds played and won,
+// dungeons and raids entered and total kills.
+var defaultStatistics = []int{60, 97, 98, 328, 349, 353, 588, 839, 840, 932, 933, 1197}
+
+// trackedStatistics returns the statistic ids listed in ACHIEVEMENT_STATISTICS (comma separated, defaults to
+// defaultStatistics), nil if it is "all" and all statistics are stored. It is read once.
+var trackedStatistics = sync.OnceValue(func() map[int]struct{} {
+	value := goDotEnvVariable("ACHIEVEMENT_STATISTICS")
+	if value == "all" {
+		return nil
+	}
+	ids := map[int]struct{}{}
+	if value == "" {
+		for _, id := range defaultStatistics {
+			ids[id] = struct{}{}
+		}
+		return ids
+	}
+	for _, field := range strings.Split(value, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			log.Printf("Ignoring invalid statistic id '%s' in ACHIEVEMENT_STATISTICS", field)
+			continue
+		}
+		ids[id] = struct{}{}
+	}
+	return ids
+})
+
+// saveStatistics stores the tracked statistics of a character in the "statistics" field of "character_achievements".
+func saveStatistics(app core.App, character *core.Record, data any, runID string) error {
+	summary := data.(*wowp.CharacterAchievementsStatistics)
+
+	tracked := trackedStatistics()
+	statistics := map[string]statistic{}
+	add := func(list wowp.Statistics) {
+		for _, s := range list {
+			if _, ok := tracked[s.ID]; tracked == nil || ok {
+				statistics[strconv.Itoa(s.ID)] = statistic{Name: s.Name, Quantity: s.Quantity}
+			}
+		}
+	}
+	for _, category := range summary.Categories {
+		add(category.Statistics)
+		for _, subCategory := range category.SubCategories {
+			add(subCategory.Statistics)
+		}
+	}
+	return syncCharacterRecord(app, "character_achievements", character, map[string]any{"statistics": statistics})
+}
+
+// guildAchievements returns the achievements the members of a guild earned recently, newest first.
+// The optional "days" query parameter sets how far back to look (defaults to 7).
+// New entries can also be followed with a realtime subscription to "guild_achievement_feed".
+func guildAchievements(e *core.RequestEvent) error {
+	guild, err := e.App.FindRecordById("guilds", e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Guild not found.", err)
+	}
+	days, err := queryDays(e, 7)
+	if err != nil {
+		return err
+	}
+	since := types.NowDateTime().AddDate(0, 0, -days)
+
+	records, err := e.App.FindRecordsByFilter("guild_achievement_feed", "guild = {:guild} && created >= {:since}", "-created,-completed_timestamp", 0, 0, dbx.Params{"guild": guild.Id, "since": since.String()})
+	if err != nil {
+		return e.InternalServerError("Failed to load the achievement feed.", err)
+	}
+
+	type entry struct {
+		Character          string `json:"character"`
+		Name               string `json:"name"`
+		Realm              string `json:"realm"`
+		AchievementID      int    `json:"achievement_id"`
+		AchievementName    string `json:"achievement_name"`
+		CompletedTimestamp int64  `json:"completed_timestamp"`
+		Created            string `json:"created"`
+	}
+	feed := make([]entry, 0, len(records))
+	for _, record := range records {
+		feed = append(feed, entry{
+			Character:          record.GetString("character"),
+			Name:               record.GetString("character_name"),
+			Realm:              record.GetString("realm"),
+			AchievementID:      record.GetInt("achievement_id"),
+			AchievementName:    record.GetString("achievement_name"),
+			CompletedTimestamp: int64(record.GetFloat("completed_timestamp")),
+			Created:            record.GetString("created"),
+		})
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"guild": guild.Id,
+		"days":  days,
+		"feed":  feed,
+	})
+}
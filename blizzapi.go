@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// errNotFound is returned by getProfileData for profiles Blizzard has no data for,
+// e.g. the Mythic Keystone season of a character that never ran a key.
+var errNotFound = errors.New("404 Not Found")
+
+var (
+	apiClientsMu sync.Mutex
+	apiClients   = map[string]*http.Client{}
+)
+
+// apiHTTPClient returns an authorized HTTP client for the OAuth host of the given Blizzard client,
+// sharing the throttled transport with the blizzard library.
+func apiHTTPClient(client *blizzard.Client) *http.Client {
+	apiClientsMu.Lock()
+	defer apiClientsMu.Unlock()
+
+	host := client.GetOAuthHost()
+	if httpClient, ok := apiClients[host]; ok {
+		return httpClient
+	}
+	config := clientcredentials.Config{
+		ClientID:     goDotEnvVariable("CLIENT_ID"),
+		ClientSecret: goDotEnvVariable("CLIENT_SECRET"),
+		TokenURL:     host + "/token",
+	}
+	httpClient := config.Client(context.WithValue(context.Background(), oauth2.HTTPClient, throttledClient))
+	apiClients[host] = httpClient
+	return httpClient
+}
+
+// getProfileData fetches a profile API path in the region and locale of the given client and decodes it into dst.
+// It is used for endpoints where the blizzard library structures lack fields we need.
+func getProfileData(ctx context.Context, client *blizzard.Client, path string, dst any) error {
+	return getAPIData(ctx, client, client.GetProfileNamespace(), path, dst)
+}
+
+// getStaticData is getProfileData for game data paths in the static namespace.
+func getStaticData(ctx context.Context, client *blizzard.Client, path string, dst any) error {
+	return getAPIData(ctx, client, client.GetStaticNamespace(), path, dst)
+}
+
+func getAPIData(ctx context.Context, client *blizzard.Client, namespace, path string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", client.GetAPIHost()+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Battlenet-Namespace", namespace)
+	q := req.URL.Query()
+	q.Set("locale", client.GetLocale().String())
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := apiHTTPClient(client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
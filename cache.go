@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// errNotModified is returned for conditional requests Blizzard answered with 304,
+// the data is unchanged since the last sync and doesn't need to be diffed again.
+var errNotModified = errors.New("304 Not Modified")
+
+// cacheMaxAge forces an unconditional request once a cache entry is older, so data that
+// went missing after it was saved (e.g. a record deleted by hand) is fetched again.
+const cacheMaxAge = 24 * time.Hour
+
+type noCacheKey struct{}
+
+// withoutCache disables conditional requests for calls using the returned context,
+// e.g. for characters not stored yet or responses that are always needed like the roster.
+func withoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+type pendingValidatorsKey struct{}
+
+// pendingValidators holds the validators of the responses of requests using its context until the data
+// of those responses is saved. Committing them right away would turn the next request for data whose save
+// failed into a 304, and the data would be skipped until the entry expires.
+type pendingValidators struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// withPendingValidators keeps the validators of the responses to calls using the returned context
+// in the returned pendingValidators, they are added to the cache with CachingTransport.commit.
+func withPendingValidators(ctx context.Context) (context.Context, *pendingValidators) {
+	pending := &pendingValidators{entries: map[string]*cacheEntry{}}
+	return context.WithValue(ctx, pendingValidatorsKey{}, pending), pending
+}
+
+// discardPendingValidators drops the validators collected with the context, e.g. if only part of the data
+// of a response could be used, so the next run requests it in full again.
+func discardPendingValidators(ctx context.Context) {
+	if pending, ok := ctx.Value(pendingValidatorsKey{}).(*pendingValidators); ok {
+		pending.mu.Lock()
+		clear(pending.entries)
+		pending.mu.Unlock()
+	}
+}
+
+type cacheEntry struct {
+	etag         string
+	lastModified string
+	storedAt     time.Time
+	dirty        bool
+}
+
+// CachingTransport sends conditional GET requests using the ETag and Last-Modified
+// validators of earlier responses, which are persisted in the "http_cache" collection.
+type CachingTransport struct {
+	roundTripperWrap http.RoundTripper
+
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]*cacheEntry
+}
+
+func NewCachingTransport(transportWrap http.RoundTripper) *CachingTransport {
+	return &CachingTransport{
+		roundTripperWrap: transportWrap,
+		entries:          map[string]*cacheEntry{},
+	}
+}
+
+// cacheKey includes the namespace header, the same path returns different data per namespace.
+func cacheKey(r *http.Request) string {
+	return r.Header.Get("Battlenet-Namespace") + " " + r.URL.String()
+}
+
+func (c *CachingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method != http.MethodGet {
+		return c.roundTripperWrap.RoundTrip(r)
+	}
+	key := cacheKey(r)
+
+	if noCache, _ := r.Context().Value(noCacheKey{}).(bool); !noCache {
+		c.mu.Lock()
+		entry, ok := c.entries[key]
+		if ok && time.Since(entry.storedAt) < cacheMaxAge {
+			r = r.Clone(r.Context())
+			if entry.etag != "" {
+				r.Header.Set("If-None-Match", entry.etag)
+			}
+			if entry.lastModified != "" {
+				r.Header.Set("If-Modified-Since", entry.lastModified)
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	resp, err := c.roundTripperWrap.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, errNotModified
+	}
+	if resp.StatusCode == http.StatusOK {
+		etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			entry := &cacheEntry{etag: etag, lastModified: lastModified, storedAt: time.Now(), dirty: true}
+			if pending, ok := r.Context().Value(pendingValidatorsKey{}).(*pendingValidators); ok {
+				pending.mu.Lock()
+				pending.entries[key] = entry
+				pending.mu.Unlock()
+			} else {
+				c.mu.Lock()
+				c.entries[key] = entry
+				c.mu.Unlock()
+			}
+		}
+	}
+	return resp, nil
+}
+
+// commit adds the pending validators of requests whose data was saved to the cache,
+// they are written to the database with the next persist.
+func (c *CachingTransport) commit(pending ...*pendingValidators) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range pending {
+		if p == nil {
+			continue
+		}
+		p.mu.Lock()
+		for key, entry := range p.entries {
+			c.entries[key] = entry
+		}
+		p.mu.Unlock()
+	}
+}
+
+// load reads the persisted validators once after startup.
+func (c *CachingTransport) load(app core.App) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loaded {
+		return
+	}
+
+	records, err := app.FindAllRecords("http_cache")
+	if err != nil {
+		log.Printf("Error loading http cache: %v", err)
+		return
+	}
+	for _, record := range records {
+		key := record.GetString("key")
+		if _, ok := c.entries[key]; ok {
+			continue // already refreshed by a request
+		}
+		c.entries[key] = &cacheEntry{
+			etag:         record.GetString("etag"),
+			lastModified: record.GetString("last_modified"),
+			storedAt:     record.GetDateTime("updated").Time(),
+		}
+	}
+	c.loaded = true
+	log.Printf("Loaded %d http cache entries.", len(records))
+}
+
+// persist saves the validators received since the last call, it is called after every sync
+// instead of per response to keep the database writes out of the fetch loop.
+func (c *CachingTransport) persist(app core.App) {
+	c.mu.Lock()
+	dirty := map[string]cacheEntry{}
+	for key, entry := range c.entries {
+		if entry.dirty {
+			dirty[key] = *entry
+			entry.dirty = false
+		}
+	}
+	c.mu.Unlock()
+	if len(dirty) == 0 {
+		return
+	}
+
+	collection, err := app.FindCollectionByNameOrId("http_cache")
+	if err != nil {
+		log.Printf("Error finding collection: %v", err)
+		return
+	}
+	for key, entry := range dirty {
+		record, err := app.FindFirstRecordByData(collection, "key", key)
+		if err != nil {
+			record = core.NewRecord(collection)
+			record.Set("key", key)
+		}
+		record.Set("etag", entry.etag)
+		record.Set("last_modified", entry.lastModified)
+		if err := app.Save(record); err != nil {
+			log.Printf("Error saving http cache entry %s: %v", key, err)
+		}
+	}
+}
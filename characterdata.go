@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// characterSync fetches an additional profile endpoint for every roster member
+// and stores it in collections linked to the "characters" record.
+// The optional release frees what the fetched data holds besides memory, e.g. temporary files.
+type characterSync struct {
+	name    string
+	fetch   func(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error)
+	save    func(app core.App, character *core.Record, data any, runID string) error
+	release func(data any)
+}
+
+var characterSyncs []characterSync
+
+// registerCharacterSync adds a sync to the per member fetch loop, meant to be called from init.
+func registerCharacterSync(sync characterSync) {
+	characterSyncs = append(characterSyncs, sync)
+}
+
+// characterData is the fetched, not yet saved result of a characterSync.
+type characterData struct {
+	sync       characterSync
+	data       any
+	validators *pendingValidators
+}
+
+// fetchCharacterData runs the fetch of all registered syncs for a single character,
+// syncs whose data didn't change since the last run are left out.
+func fetchCharacterData(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) []characterData {
+	fetched := make([]characterData, 0, len(characterSyncs))
+	for _, sync := range characterSyncs {
+		syncCtx, validators := withPendingValidators(ctx)
+		data, err := sync.fetch(syncCtx, client, realmSlug, characterName)
+		if errors.Is(err, errNotModified) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error fetching %s for %s-%s: %v", sync.name, characterName, realmSlug, err)
+			continue
+		}
+		fetched = append(fetched, characterData{sync: sync, data: data, validators: validators})
+	}
+	return fetched
+}
+
+// saveCharacterData saves the fetched data of a single, already saved character and returns the cache
+// validators of the syncs that were saved, together with the errors of those that failed.
+func saveCharacterData(app core.App, character *core.Record, fetched []characterData, runID string) ([]*pendingValidators, error) {
+	saved := make([]*pendingValidators, 0, len(fetched))
+	var errs []error
+	for _, f := range fetched {
+		if err := f.sync.save(app, character, f.data, runID); err != nil {
+			errs = append(errs, fmt.Errorf("saving %s for %s-%s: %w", f.sync.name, character.GetString("name"), character.GetString("realm"), err))
+			continue
+		}
+		saved = append(saved, f.validators)
+	}
+	return saved, errors.Join(errs...)
+}
+
+// releaseCharacterData releases the fetched data of a single character once it was written or discarded.
+func releaseCharacterData(fetched []characterData) {
+	for _, f := range fetched {
+		if f.sync.release != nil {
+			f.sync.release(f.data)
+		}
+	}
+}
+
+// syncChildRecords diffs the records of a collection linked to a character through its "character" field
+// against the given rows, keyed by the value of keyField. Changed rows are updated the same way characters are,
+// new rows are inserted and records without a matching row are deleted. The errors of failed writes are returned,
+// so the cache validators of the data stay uncommitted and it is fetched in full again.
+func syncChildRecords(app core.App, collectionName string, character *core.Record, keyField string, rows map[string]map[string]any) error {
+	return syncChildRecordsWithHistory(app, collectionName, character, keyField, rows, "")
+}
+
+// syncChildRecordsWithHistory works like syncChildRecords and additionally records the changes of the given fields
+// of updated rows in the character history, named "<collection>.<key>.<field>", e.g. "character_talents.62.loadout_code".
+func syncChildRecordsWithHistory(app core.App, collectionName string, character *core.Record, keyField string, rows map[string]map[string]any, runID string, historyFields ...string) error {
+	collection, err := app.FindCollectionByNameOrId(collectionName)
+	if err != nil {
+		return err
+	}
+	records, err := app.FindAllRecords(collection, dbx.HashExp{"character": character.Id})
+	if err != nil {
+		return err
+	}
+
+	existingRecords := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		existingRecords[record.GetString(keyField)] = record
+	}
+
+	var history []fieldChange
+	var errs []error
+	for key, fieldValues := range rows {
+		record, ok := existingRecords[key]
+		if ok {
+			delete(existingRecords, key)
+			changes := diffRecordFields(record, fieldValues)
+			if len(changes) == 0 {
+				continue
+			}
+			history = append(history, childHistory(collectionName, key, changes, historyFields)...)
+		} else {
+			record = core.NewRecord(collection)
+			record.Set("character", character.Id)
+			record.Set(keyField, key)
+		}
+		setRecordFields(record, collection, fieldValues)
+		if err := app.Save(record); err != nil {
+			errs = append(errs, fmt.Errorf("saving %s '%s': %w", collectionName, key, err))
+		}
+	}
+
+	for key, record := range existingRecords {
+		if err := app.Delete(record); err != nil {
+			errs = append(errs, fmt.Errorf("deleting %s '%s': %w", collectionName, key, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	return saveHistory(app, character.Id, runID, history)
+}
+
+// childHistory returns the changes of the history fields of a child row, named after the collection and row key.
+func childHistory(collectionName, key string, changes []fieldChange, historyFields []string) []fieldChange {
+	var history []fieldChange
+	for _, change := range changes {
+		if slices.Contains(historyFields, change.field) {
+			change.field = collectionName + "." + key + "." + change.field
+			history = append(history, change)
+		}
+	}
+	return history
+}
+
+// syncCharacterRecord stores the given fields in the single record a collection holds per character,
+// the record is created with the first sync and only saved again if one of the fields changed.
+func syncCharacterRecord(app core.App, collectionName string, character *core.Record, fieldValues map[string]any) error {
+	collection, err := app.FindCollectionByNameOrId(collectionName)
+	if err != nil {
+		return err
+	}
+	record, err := app.FindFirstRecordByData(collection, "character", character.Id)
+	if err != nil {
+		record = core.NewRecord(collection)
+		record.Set("character", character.Id)
+	} else if len(diffRecordFields(record, fieldValues)) == 0 {
+		return nil
+	}
+	setRecordFields(record, collection, fieldValues)
+	return app.Save(record)
+}
+
+// expandError joins the errors of App.ExpandRecords (keyed by the failed expand path) into one error.
+func expandError(errs map[string]error) error {
+	joined := make([]error, 0, len(errs))
+	for path, err := range errs {
+		joined = append(joined, fmt.Errorf("%s: %w", path, err))
+	}
+	return errors.Join(joined...)
+}
+
+// memberFilter limits a query to the rows whose column references a current (not departed) member.
+// The optional "guild" query parameter of the request narrows it to the members of that tracked guild.
+func memberFilter(e *core.RequestEvent, column string) dbx.Expression {
+	query := "[[" + column + "]] IN (SELECT [[id]] FROM {{characters}} WHERE [[status]] != 'left'"
+	params := dbx.Params{}
+	if guild := e.Request.URL.Query().Get("guild"); guild != "" {
+		query += " AND [[guild]] = {:guild}"
+		params["guild"] = guild
+	}
+	return dbx.NewExp(query+")", params)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// mediaFields maps the asset keys of the character media endpoint to the file fields of the characters,
+// the url the file was downloaded from is kept in the "<field>_url" field.
+var mediaFields = map[string]string{
+	"avatar":   "avatar",
+	"inset":    "inset",
+	"main-raw": "main_raw",
+}
+
+// mediaDownloadTimeout limits a single image download from the Blizzard render CDN.
+const mediaDownloadTimeout = 30 * time.Second
+
+// mediaMaxSize is the size limit of a downloaded image, the largest one of the file fields.
+const mediaMaxSize = 10 << 20
+
+type storedMediaKey struct{}
+
+// withStoredMedia passes the asset urls of the images a stored character already has to the media fetch
+// using the returned context, they aren't downloaded again.
+func withStoredMedia(ctx context.Context, character *core.Record) context.Context {
+	urls := make(map[string]string, len(mediaFields))
+	for _, field := range mediaFields {
+		if character.GetString(field) != "" {
+			urls[field] = character.GetString(field + "_url")
+		}
+	}
+	return context.WithValue(ctx, storedMediaKey{}, urls)
+}
+
+// characterMedia are the downloaded images of a character keyed by file field, with the urls they were downloaded from.
+// The images are streamed to files in a temporary directory, removed once the data was written.
+type characterMedia struct {
+	dir   string
+	files map[string]*filesystem.File
+	urls  map[string]string
+}
+
+func init() {
+	registerCharacterSync(characterSync{
+		name:    "media",
+		fetch:   fetchCharacterMedia,
+		save:    saveCharacterMedia,
+		release: releaseCharacterMedia,
+	})
+}
+
+// fetchCharacterMedia downloads the character images whose asset url changed. The downloads run in the fetch
+// with the other network calls, so the save doesn't hold the write transaction while waiting for the CDN.
+// If a download fails the media response is requested in full again by the next run, which retries it.
+func fetchCharacterMedia(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+	summary, _, err := client.WoWCharacterMediaSummary(ctx, realmSlug, characterName)
+	if err != nil {
+		return nil, err
+	}
+	stored, _ := ctx.Value(storedMediaKey{}).(map[string]string)
+
+	media := &characterMedia{files: map[string]*filesystem.File{}, urls: map[string]string{}}
+	failed := false
+	for _, asset := range summary.Assets {
+		field, ok := mediaFields[asset.Key]
+		if !ok || asset.Value == "" || stored[field] == asset.Value {
+			continue
+		}
+		if media.dir == "" {
+			media.dir, err = os.MkdirTemp("", "blizbase-media-")
+			if err != nil {
+				return nil, err
+			}
+		}
+		file, err := downloadMedia(ctx, media.dir, field, asset.Value)
+		if err != nil {
+			log.Printf("Error downloading %s of %s: %v", asset.Key, characterName, err)
+			failed = true
+			continue
+		}
+		media.files[field] = file
+		media.urls[field] = asset.Value
+	}
+	if failed {
+		discardPendingValidators(ctx)
+	}
+	return media, nil
+}
+
+// downloadMedia streams an image from the Blizzard render CDN to a file named after the file field in dir.
+func downloadMedia(ctx context.Context, dir, field, url string) (*filesystem.File, error) {
+	ctx, cancel := context.WithTimeout(ctx, mediaDownloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Join(dir, field+path.Ext(req.URL.Path))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	out, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(out, io.LimitReader(resp.Body, mediaMaxSize+1))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size > mediaMaxSize {
+		return nil, fmt.Errorf("larger than %d bytes", mediaMaxSize)
+	}
+	return filesystem.NewFileFromPath(name)
+}
+
+// saveCharacterMedia stores the downloaded images in the file fields of the character.
+func saveCharacterMedia(app core.App, character *core.Record, data any, runID string) error {
+	media := data.(*characterMedia)
+	if len(media.files) == 0 {
+		return nil
+	}
+	for field, file := range media.files {
+		character.Set(field, file)
+		character.Set(field+"_url", media.urls[field])
+	}
+	return app.Save(character)
+}
+
+// releaseCharacterMedia removes the temporary directory of the downloaded images.
+func releaseCharacterMedia(data any) {
+	media := data.(*characterMedia)
+	if media.dir == "" {
+		return
+	}
+	if err := os.RemoveAll(media.dir); err != nil {
+		log.Printf("Error removing %s: %v", media.dir, err)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type collectionRef struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+}
+
+// collectionType describes a collections endpoint, ids extracts the collected ids from its decoded response.
+type collectionType struct {
+	name string
+	ids  func(ctx context.Context, client *blizzard.Client, path string) ([]int, error)
+}
+
+// getCollectionIDs fetches a collections endpoint into T and returns the ids selected by ids.
+func getCollectionIDs[T any](ids func(T) []int) func(ctx context.Context, client *blizzard.Client, path string) ([]int, error) {
+	return func(ctx context.Context, client *blizzard.Client, path string) ([]int, error) {
+		var collection T
+		if err := getProfileData(ctx, client, path, &collection); err != nil {
+			return nil, err
+		}
+		return ids(collection), nil
+	}
+}
+
+// collectionTypes are the collections that can be enabled per guild in its "collections" field,
+// they are account wide, so all characters of an account share them and the alts can be skipped.
+var collectionTypes = []collectionType{
+	{name: "mounts", ids: getCollectionIDs(func(c struct {
+		Mounts []struct {
+			Mount collectionRef `json:"mount"`
+		} `json:"mounts"`
+	}) []int {
+		ids := make([]int, 0, len(c.Mounts))
+		for _, m := range c.Mounts {
+			ids = append(ids, m.Mount.ID)
+		}
+		return ids
+	})},
+	{name: "pets", ids: getCollectionIDs(func(c struct {
+		Pets []struct {
+			Species collectionRef `json:"species"`
+		} `json:"pets"`
+	}) []int {
+		ids := make([]int, 0, len(c.Pets))
+		for _, p := range c.Pets {
+			ids = append(ids, p.Species.ID)
+		}
+		return ids
+	})},
+	{name: "toys", ids: getCollectionIDs(func(c struct {
+		Toys []struct {
+			Toy collectionRef `json:"toy"`
+		} `json:"toys"`
+	}) []int {
+		ids := make([]int, 0, len(c.Toys))
+		for _, t := range c.Toys {
+			ids = append(ids, t.Toy.ID)
+		}
+		return ids
+	})},
+	{name: "heirlooms", ids: getCollectionIDs(func(c struct {
+		Heirlooms []struct {
+			Heirloom collectionRef `json:"heirloom"`
+		} `json:"heirlooms"`
+	}) []int {
+		ids := make([]int, 0, len(c.Heirlooms))
+		for _, h := range c.Heirlooms {
+			ids = append(ids, h.Heirloom.ID)
+		}
+		return ids
+	})},
+	{name: "transmogs", ids: getCollectionIDs(func(c struct {
+		Slots []struct {
+			Appearances []struct {
+				ID int `json:"id"`
+			} `json:"appearances"`
+		} `json:"slots"`
+	}) []int {
+		var ids []int
+		for _, slot := range c.Slots {
+			for _, a := range slot.Appearances {
+				ids = append(ids, a.ID)
+			}
+		}
+		return ids
+	})},
+}
+
+var collectionTypeNames = func() []string {
+	names := make([]string, 0, len(collectionTypes))
+	for _, t := range collectionTypes {
+		names = append(names, t.name)
+	}
+	return names
+}()
+
+type collectionSettingsKey struct{}
+
+// collectionSettings are the collection types enabled for a guild and the ranks of its alts.
+type collectionSettings struct {
+	types    []string
+	altRanks []int
+}
+
+// withCollectionSettings passes the collection settings of the guild synced with the returned context
+// to the collections fetch, from its "collections" and "collection_alt_ranks" fields.
+func withCollectionSettings(ctx context.Context, guild *core.Record) context.Context {
+	settings := collectionSettings{types: guild.GetStringSlice("collections")}
+	if err := guild.UnmarshalJSONField("collection_alt_ranks", &settings.altRanks); err != nil {
+		log.Printf("Ignoring invalid collection_alt_ranks of %s-%s: %v", guild.GetString("guild_slug"), guild.GetString("realm_slug"), err)
+	}
+	return context.WithValue(ctx, collectionSettingsKey{}, settings)
+}
+
+// characterCollections are the fetched collections of a character: the ids of the types that changed
+// and the types that are no longer synced for it, whose records are deleted.
+type characterCollections struct {
+	changed  map[string][]int
+	disabled []string
+}
+
+func init() {
+	registerCharacterSync(characterSync{
+		name:  "collections",
+		fetch: fetchCollections,
+		save:  saveCollections,
+	})
+}
+
+// fetchCollections fetches the collections enabled for the guild of the character. Members of an alt rank
+// are skipped, their account wide collections are already stored with their main.
+func fetchCollections(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+	settings, _ := ctx.Value(collectionSettingsKey{}).(collectionSettings)
+	member, _ := ctx.Value(rosterMemberKey{}).(rosterMember)
+	alt := slices.Contains(settings.altRanks, member.rank)
+	path := fmt.Sprintf("/profile/wow/character/%s/%s/collections/", realmSlug, url.PathEscape(strings.ToLower(characterName)))
+
+	collections := &characterCollections{changed: map[string][]int{}}
+	for _, t := range collectionTypes {
+		if alt || !slices.Contains(settings.types, t.name) {
+			collections.disabled = append(collections.disabled, t.name)
+			continue
+		}
+		ids, err := t.ids(ctx, client, path+t.name)
+		switch {
+		case errors.Is(err, errNotModified):
+		case errors.Is(err, errNotFound):
+			collections.changed[t.name] = []int{}
+		case err != nil:
+			return nil, fmt.Errorf("failed to fetch %s: %w", t.name, err)
+		default:
+			collections.changed[t.name] = ids
+		}
+	}
+	return collections, nil
+}
+
+// saveCollections stores one "character_collections" record per enabled collection type
+// and deletes the records of the types that aren't synced for the character.
+func saveCollections(app core.App, character *core.Record, data any, runID string) error {
+	collections := data.(*characterCollections)
+
+	collection, err := app.FindCollectionByNameOrId("character_collections")
+	if err != nil {
+		return err
+	}
+	if len(collections.disabled) > 0 {
+		types := make([]any, 0, len(collections.disabled))
+		for _, name := range collections.disabled {
+			types = append(types, name)
+		}
+		disabled, err := app.FindAllRecords(collection, dbx.HashExp{"character": character.Id}, dbx.In("type", types...))
+		if err != nil {
+			return err
+		}
+		for _, record := range disabled {
+			if err := app.Delete(record); err != nil {
+				return fmt.Errorf("deleting %s: %w", record.GetString("type"), err)
+			}
+		}
+	}
+
+	for name, ids := range collections.changed {
+		ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+		if ids == nil {
+			ids = []int{}
+		}
+		fieldValues := map[string]any{"count": len(ids), "ids": ids}
+		record, err := app.FindFirstRecordByFilter(collection, "character = {:character} && type = {:type}", dbx.Params{"character": character.Id, "type": name})
+		if err != nil {
+			record = core.NewRecord(collection)
+			record.Set("character", character.Id)
+			record.Set("type", name)
+		} else if len(diffRecordFields(record, fieldValues)) == 0 {
+			continue
+		}
+		setRecordFields(record, collection, fieldValues)
+		if err := app.Save(record); err != nil {
+			return fmt.Errorf("saving %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// collectionMissing answers "who is missing mount X": it lists the members (see memberFilter) whose synced
+// collection of the "type" query parameter (defaults to mounts) lacks the "id" query parameter, e.g. ?type=mounts&id=1234.
+func collectionMissing(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+	collectionName := query.Get("type")
+	if collectionName == "" {
+		collectionName = "mounts"
+	}
+	if !slices.Contains(collectionTypeNames, collectionName) {
+		return e.BadRequestError("Invalid type value.", nil)
+	}
+	id, err := strconv.Atoi(query.Get("id"))
+	if err != nil {
+		return e.BadRequestError("Invalid id value.", err)
+	}
+
+	var records []*core.Record
+	err = e.App.RecordQuery("character_collections").
+		AndWhere(dbx.HashExp{"type": collectionName}).
+		AndWhere(dbx.NewExp("NOT EXISTS (SELECT 1 FROM json_each([[character_collections.ids]]) WHERE [[value]] = {:id})", dbx.Params{"id": id})).
+		AndWhere(memberFilter(e, "character_collections.character")).
+		All(&records)
+	if err != nil {
+		return e.InternalServerError("Failed to load the collections.", err)
+	}
+	if errs := e.App.ExpandRecords(records, []string{"character"}, nil); len(errs) > 0 {
+		return e.InternalServerError("Failed to load the collection characters.", expandError(errs))
+	}
+
+	type entry struct {
+		Character string `json:"character"`
+		Name      string `json:"name"`
+		Realm     string `json:"realm"`
+		Count     int    `json:"count"`
+	}
+	missing := make([]entry, 0, len(records))
+	for _, record := range records {
+		character := record.ExpandedOne("character")
+		if character == nil {
+			continue
+		}
+		missing = append(missing, entry{
+			Character: character.Id,
+			Name:      character.GetString("name"),
+			Realm:     character.GetString("realm"),
+			Count:     record.GetInt("count"),
+		})
+	}
+	slices.SortFunc(missing, func(a, b entry) int { return strings.Compare(a.Name, b.Name) })
+	return e.JSON(http.StatusOK, map[string]any{
+		"type":    collectionName,
+		"id":      id,
+		"missing": missing,
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/FuzzyStatic/blizzard/v3/wowp"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type equipmentEnchantment struct {
+	ID            int    `json:"id"`
+	DisplayString string `json:"display_string"`
+	SourceItemID  int    `json:"source_item_id"`
+}
+
+type equipmentGem struct {
+	SocketType    string `json:"socket_type"`
+	ItemID        int    `json:"item_id"`
+	Name          string `json:"name"`
+	DisplayString string `json:"display_string"`
+}
+
+type equipmentSetBonus struct {
+	DisplayString string `json:"display_string"`
+	RequiredCount int    `json:"required_count"`
+	IsActive      bool   `json:"is_active"`
+}
+
+func init() {
+	registerCharacterSync(characterSync{
+		name: "equipment",
+		fetch: func(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+			equipment, _, err := client.WoWCharacterEquipmentSummary(ctx, realmSlug, characterName)
+			return equipment, err
+		},
+		save: saveEquipment,
+	})
+}
+
+// saveEquipment stores one "character_equipment" record per equipped slot.
+func saveEquipment(app core.App, character *core.Record, data any, runID string) error {
+	equipment := data.(*wowp.CharacterEquipmentSummary)
+
+	rows := make(map[string]map[string]any, len(equipment.EquippedItems))
+	for _, item := range equipment.EquippedItems {
+		enchantments := make([]equipmentEnchantment, 0, len(item.Enchantments))
+		for _, enchantment := range item.Enchantments {
+			enchantments = append(enchantments, equipmentEnchantment{
+				ID:            enchantment.EnchantmentID,
+				DisplayString: enchantment.DisplayString,
+				SourceItemID:  enchantment.SourceItem.ID,
+			})
+		}
+
+		gems := make([]equipmentGem, 0, len(item.Sockets))
+		emptySockets := 0
+		for _, socket := range item.Sockets {
+			if socket.Item.ID == 0 {
+				emptySockets++
+				continue
+			}
+			gems = append(gems, equipmentGem{
+				SocketType:    socket.SocketType.Type,
+				ItemID:        socket.Item.ID,
+				Name:          socket.Item.Name,
+				DisplayString: socket.DisplayString,
+			})
+		}
+
+		setBonuses := make([]equipmentSetBonus, 0, len(item.Set.Effects))
+		for _, effect := range item.Set.Effects {
+			setBonuses = append(setBonuses, equipmentSetBonus{
+				DisplayString: effect.DisplayString,
+				RequiredCount: effect.RequiredCount,
+				IsActive:      effect.IsActive,
+			})
+		}
+
+		rows[item.Slot.Type] = map[string]any{
+			"slot_name":     item.Slot.Name,
+			"item_id":       item.Item.ID,
+			"name":          item.Name,
+			"item_level":    item.Level.Value,
+			"quality":       item.Quality.Type,
+			"enchantments":  enchantments,
+			"gems":          gems,
+			"sockets":       len(item.Sockets),
+			"empty_sockets": emptySockets,
+			"set_name":      item.Set.ItemSet.Name,
+			"set_bonuses":   setBonuses,
+		}
+	}
+
+	return syncChildRecords(app, "character_equipment", character, "slot", rows)
+}
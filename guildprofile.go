@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// recentAchievementsLimit is the number of recently earned guild achievements kept on the guild.
+const recentAchievementsLimit = 10
+
+type guildAchievement struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// rgba formats a crest color as css color.
+func rgba(r, g, b int, a float32) string {
+	return fmt.Sprintf("rgba(%d, %d, %d, %g)", r, g, b, a)
+}
+
+// guildProfilesMu prevents the guild profile updates of the GuildProfile cron, the run at startup
+// and newly added guilds from overlapping.
+var guildProfilesMu sync.Mutex
+
+// syncGuildProfiles updates the profile, crest and achievements of every enabled guild.
+// It runs on its own cron as the guild data changes a lot less often than the roster, and once at startup.
+func syncGuildProfiles(app core.App) {
+	if !guildProfilesMu.TryLock() {
+		log.Printf("Previous guild profile update still running, skipping this one.")
+		return
+	}
+	defer guildProfilesMu.Unlock()
+
+	blizzCache.load(app)
+	defer blizzCache.persist(app)
+
+	guilds, err := app.FindAllRecords("guilds", dbx.HashExp{"enabled": true})
+	if err != nil {
+		log.Printf("Error finding guilds: %v", err)
+		return
+	}
+	for _, guild := range guilds {
+		updateGuildProfile(app, guild)
+	}
+}
+
+// syncNewGuildProfile updates the profile of a guild right after it was added, so it doesn't wait for the next
+// GuildProfile run. It waits for a running update of all guilds to finish instead of being skipped.
+func syncNewGuildProfile(app core.App, guild *core.Record) {
+	guildProfilesMu.Lock()
+	defer guildProfilesMu.Unlock()
+
+	blizzCache.load(app)
+	defer blizzCache.persist(app)
+
+	updateGuildProfile(app, guild)
+}
+
+// updateGuildProfile updates the profile of a single guild with the client of its region and locale.
+func updateGuildProfile(app core.App, guild *core.Record) {
+	ctx := context.Background()
+	region, locale, err := parseRegion(guild.GetString("region"), guild.GetString("locale"))
+	if err != nil {
+		log.Printf("Skipping profile of %s-%s: %v", guild.GetString("guild_slug"), guild.GetString("realm_slug"), err)
+		return
+	}
+	client, err := getBlizzClient(ctx, region, locale)
+	if err != nil {
+		log.Printf("Skipping profile of %s-%s: %v", guild.GetString("guild_slug"), guild.GetString("realm_slug"), err)
+		return
+	}
+	profileCtx, validators := withPendingValidators(ctx)
+	if err := syncGuildProfile(profileCtx, app, client, guild); err != nil {
+		log.Printf("Error updating profile of %s-%s: %v", guild.GetString("guild_slug"), guild.GetString("realm_slug"), err)
+		return
+	}
+	blizzCache.commit(validators)
+}
+
+// syncGuildProfile stores the guild profile, crest and achievements on the guild record.
+// Endpoints unchanged since the last sync are skipped, the crest media is only requested when the crest changed.
+func syncGuildProfile(ctx context.Context, app core.App, client *blizzard.Client, guild *core.Record) error {
+	realmSlug := guild.GetString("realm_slug")
+	guildSlug := guild.GetString("guild_slug")
+	fieldValues := map[string]any{}
+
+	profile, _, err := client.WoWGuild(ctx, realmSlug, guildSlug)
+	if err == nil {
+		crest := profile.Crest
+		fieldValues["name"] = profile.Name
+		fieldValues["faction_type"] = profile.Faction.Type
+		fieldValues["faction_name"] = profile.Faction.Name
+		fieldValues["member_count"] = profile.MemberCount
+		fieldValues["achievement_points"] = profile.AchievementPoints
+		fieldValues["created_timestamp"] = profile.CreatedTimestamp
+		fieldValues["crest"] = map[string]any{
+			"emblem_id":        crest.Emblem.ID,
+			"emblem_color":     rgba(crest.Emblem.Color.Rgba.R, crest.Emblem.Color.Rgba.G, crest.Emblem.Color.Rgba.B, crest.Emblem.Color.Rgba.A),
+			"border_id":        crest.Border.ID,
+			"border_color":     rgba(crest.Border.Color.Rgba.R, crest.Border.Color.Rgba.G, crest.Border.Color.Rgba.B, crest.Border.Color.Rgba.A),
+			"background_color": rgba(crest.Background.Color.Rgba.R, crest.Background.Color.Rgba.G, crest.Background.Color.Rgba.B, crest.Background.Color.Rgba.A),
+		}
+
+		var stored struct {
+			EmblemID int `json:"emblem_id"`
+			BorderID int `json:"border_id"`
+		}
+		guild.UnmarshalJSONField("crest", &stored)
+		if stored.EmblemID != crest.Emblem.ID || guild.GetString("crest_emblem_url") == "" {
+			media, _, err := client.WoWGuildCrestEmblemMedia(withoutCache(ctx), crest.Emblem.ID)
+			if err != nil {
+				return fmt.Errorf("failed to fetch crest emblem %d: %w", crest.Emblem.ID, err)
+			}
+			for _, asset := range media.Assets {
+				if asset.Key == "image" {
+					fieldValues["crest_emblem_url"] = asset.Value
+				}
+			}
+		}
+		if stored.BorderID != crest.Border.ID || guild.GetString("crest_border_url") == "" {
+			media, _, err := client.WoWGuildCrestBorderMedia(withoutCache(ctx), crest.Border.ID)
+			if err != nil {
+				return fmt.Errorf("failed to fetch crest border %d: %w", crest.Border.ID, err)
+			}
+			for _, asset := range media.Assets {
+				if asset.Key == "image" {
+					fieldValues["crest_border_url"] = asset.Value
+				}
+			}
+		}
+	} else if !errors.Is(err, errNotModified) {
+		return fmt.Errorf("failed to fetch guild profile: %w", err)
+	}
+
+	achievements, _, err := client.WoWGuildAchievements(ctx, realmSlug, guildSlug)
+	if err == nil {
+		recent := make([]guildAchievement, 0, recentAchievementsLimit)
+		for _, event := range achievements.RecentEvents {
+			if len(recent) == recentAchievementsLimit {
+				break
+			}
+			recent = append(recent, guildAchievement{ID: event.Achievement.ID, Name: event.Achievement.Name, Timestamp: event.Timestamp})
+		}
+		fieldValues["achievement_count"] = achievements.TotalQuantity
+		fieldValues["recent_achievements"] = recent
+	} else if !errors.Is(err, errNotModified) {
+		return fmt.Errorf("failed to fetch guild achievements: %w", err)
+	}
+
+	changes := diffRecordFields(guild, fieldValues)
+	if len(changes) == 0 {
+		return nil
+	}
+	for _, change := range changes {
+		log.Printf("Field '%s' changed for guild %s-%s: '%v' -> '%v'", change.field, guildSlug, realmSlug, change.oldValue, change.newValue)
+	}
+	setRecordFields(guild, guild.Collection(), fieldValues)
+	guild.Set("profile_updated", types.NowDateTime())
+	return app.Save(guild)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// saveHistory stores the detected changes of a character in the "character_history" collection.
+func saveHistory(app core.App, characterID string, runID string, changes []fieldChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	collection, err := app.FindCollectionByNameOrId("character_history")
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		record := core.NewRecord(collection)
+		record.Set("character", characterID)
+		record.Set("field", change.field)
+		record.Set("old_value", change.oldValue)
+		record.Set("new_value", change.newValue)
+		record.Set("sync_run", runID)
+		if err := app.Save(record); err != nil {
+			return fmt.Errorf("saving history of field '%s': %w", change.field, err)
+		}
+	}
+	return nil
+}
+
+// characterHistory returns the timeline of a character, oldest change first.
+// The optional "field" query parameter limits the timeline to a single field,
+// e.g. /api/blizbase/characters/{id}/history?field=equipped_item_level
+func characterHistory(e *core.RequestEvent) error {
+	character, err := e.App.FindRecordById("characters", e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Character not found.", err)
+	}
+
+	filter := "character = {:character}"
+	params := dbx.Params{"character": character.Id}
+	if field := e.Request.URL.Query().Get("field"); field != "" {
+		filter += " && field = {:field}"
+		params["field"] = field
+	}
+	records, err := e.App.FindRecordsByFilter("character_history", filter, "created", 0, 0, params)
+	if err != nil {
+		return e.InternalServerError("Failed to load the character history.", err)
+	}
+
+	type entry struct {
+		Field    string `json:"field"`
+		OldValue string `json:"old_value"`
+		NewValue string `json:"new_value"`
+		SyncRun  string `json:"sync_run"`
+		Created  string `json:"created"`
+	}
+	timeline := make([]entry, 0, len(records))
+	for _, record := range records {
+		timeline = append(timeline, entry{
+			Field:    record.GetString("field"),
+			OldValue: record.GetString("old_value"),
+			NewValue: record.GetString("new_value"),
+			SyncRun:  record.GetString("sync_run"),
+			Created:  record.GetString("created"),
+		})
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"character": character.Id,
+		"name":      character.GetString("name"),
+		"realm":     character.GetString("realm"),
+		"timeline":  timeline,
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// syncLocalizedNames stores the race, class, spec and title names in the locale of the given client,
+// so the frontend can show character names in another language than the one the guild is synced in.
+// Indexes unchanged since the last sync are skipped.
+func syncLocalizedNames(ctx context.Context, app core.App, client *blizzard.Client) error {
+	locale := client.GetLocale().String()
+	names := map[string]map[int]string{
+		"race":  {},
+		"class": {},
+		"spec":  {},
+		"title": {},
+	}
+
+	races, _, err := client.WoWPlayableRacesIndex(ctx)
+	if err == nil {
+		for _, race := range races.Races {
+			names["race"][race.ID] = race.Name
+		}
+	} else if !errors.Is(err, errNotModified) {
+		return fmt.Errorf("failed to fetch races: %w", err)
+	}
+	classes, _, err := client.WoWPlayableClassesIndex(ctx)
+	if err == nil {
+		for _, class := range classes.Classes {
+			names["class"][class.ID] = class.Name
+		}
+	} else if !errors.Is(err, errNotModified) {
+		return fmt.Errorf("failed to fetch classes: %w", err)
+	}
+	specs, _, err := client.WoWPlayableSpecializationIndex(ctx)
+	if err == nil {
+		for _, spec := range specs.CharacterSpecializations {
+			names["spec"][spec.ID] = spec.Name
+		}
+	} else if !errors.Is(err, errNotModified) {
+		return fmt.Errorf("failed to fetch specializations: %w", err)
+	}
+	titles, _, err := client.WoWTitlesIndex(ctx)
+	if err == nil {
+		for _, title := range titles.Titles {
+			names["title"][title.ID] = title.Name
+		}
+	} else if !errors.Is(err, errNotModified) {
+		return fmt.Errorf("failed to fetch titles: %w", err)
+	}
+
+	collection, err := app.FindCollectionByNameOrId("localized_names")
+	if err != nil {
+		return err
+	}
+	records, err := app.FindAllRecords(collection, dbx.HashExp{"locale": locale})
+	if err != nil {
+		return err
+	}
+	existingRecords := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		existingRecords[record.GetString("kind")+":"+strconv.Itoa(record.GetInt("game_id"))] = record
+	}
+
+	return app.RunInTransaction(func(txApp core.App) error {
+		for kind, ids := range names {
+			for id, name := range ids {
+				record, ok := existingRecords[kind+":"+strconv.Itoa(id)]
+				if ok && record.GetString("name") == name {
+					continue
+				}
+				if !ok {
+					record = core.NewRecord(collection)
+					record.Set("kind", kind)
+					record.Set("game_id", id)
+					record.Set("locale", locale)
+				}
+				record.Set("name", name)
+				if err := txApp.Save(record); err != nil {
+					log.Printf("Error saving %s name %d (%s): %v", kind, id, locale, err)
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -1,22 +1,30 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"reflect"
+	"slices"
+	"sort"
 	"strconv"
-	"time"
+	"sync"
+	"sync/atomic"
 
 	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/FuzzyStatic/blizzard/v3/wowp"
 	"github.com/joho/godotenv"
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/migrations"
 	"github.com/pocketbase/pocketbase/tools/types"
-	"golang.org/x/time/rate"
 )
 
 func goDotEnvVariable(key string) string {
@@ -24,6 +32,29 @@ func goDotEnvVariable(key string) string {
 	return os.Getenv(key)
 }
 
+// envInt returns the environment variable as integer or the fallback if it is unset or invalid.
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(goDotEnvVariable(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// queryDays returns the optional "days" query parameter of the request (the fallback if it is unset)
+// or a bad request error for an invalid value.
+func queryDays(e *core.RequestEvent, fallback int) (int, error) {
+	value := e.Request.URL.Query().Get("days")
+	if value == "" {
+		return fallback, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 {
+		return 0, e.BadRequestError("Invalid days value.", err)
+	}
+	return days, nil
+}
+
 func init() {
 	migrations.Register(func(app core.App) error {
 		superusers, err := app.FindCollectionByNameOrId(core.CollectionNameSuperusers)
@@ -115,26 +146,6 @@ func init() {
 	})
 }
 
-type ThrottledTransport struct {
-	roundTripperWrap http.RoundTripper
-	ratelimiter      *rate.Limiter
-}
-
-func (c *ThrottledTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	err := c.ratelimiter.Wait(r.Context()) // This is a blocking call. Honors the rate limit
-	if err != nil {
-		return nil, err
-	}
-	return c.roundTripperWrap.RoundTrip(r)
-}
-
-func NewThrottledTransport(limitPeriod time.Duration, requestCount int, transportWrap http.RoundTripper) http.RoundTripper {
-	return &ThrottledTransport{
-		roundTripperWrap: transportWrap,
-		ratelimiter:      rate.NewLimiter(rate.Every(limitPeriod), requestCount),
-	}
-}
-
 func normalizeValue(v any) string {
 	switch n := v.(type) {
 	case float64:
@@ -147,11 +158,46 @@ func normalizeValue(v any) string {
 			return strconv.FormatInt(int64(n), 10)
 		}
 		return strconv.FormatFloat(float64(n), 'f', -1, 32)
+	case types.JSONRaw:
+		// stored json is compact, re-compact anyway to be independent of how it was written
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, n); err != nil {
+			return n.String()
+		}
+		return buf.String()
 	default:
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.Slice, reflect.Map:
+			// values of json fields, compare them the way they will be stored
+			if raw, err := json.Marshal(v); err == nil {
+				return string(raw)
+			}
+		}
 		return fmt.Sprintf("%v", v)
 	}
 }
 
+// fieldChange describes a single field whose value differs between a record and freshly fetched data.
+type fieldChange struct {
+	field    string
+	oldValue string
+	newValue string
+}
+
+// diffRecordFields compares the normalized record values with the given field values
+// and returns all changed fields sorted by name.
+func diffRecordFields(record *core.Record, fields map[string]any) []fieldChange {
+	var changes []fieldChange
+	for key, value := range fields {
+		oldValue, newValue := normalizeValue(record.Get(key)), normalizeValue(value)
+		if oldValue != newValue {
+			changes = append(changes, fieldChange{field: key, oldValue: oldValue, newValue: newValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].field < changes[j].field })
+	return changes
+}
+
 func setRecordFields(record *core.Record, collection *core.Collection, fields map[string]any) {
 	for name, value := range fields {
 		if collection.Fields.GetByName(name) != nil {
@@ -159,33 +205,98 @@ func setRecordFields(record *core.Record, collection *core.Collection, fields ma
 		}
 	}
 }
+
+// updateRunning prevents two Update runs from overlapping when a sync takes longer than the cron interval.
+var updateRunning atomic.Bool
+
 func blizzClient(app *pocketbase.PocketBase) {
-	log.Printf("Starting update...")
+	if !updateRunning.CompareAndSwap(false, true) {
+		log.Printf("Previous update still running, skipping this one.")
+		return
+	}
+	defer updateRunning.Store(false)
+
+	runID := core.GenerateDefaultRandomId()
+	log.Printf("Starting update %s...", runID)
 	ctx := context.Background()
-	throttledClient := http.DefaultClient
-	throttledClient.Transport = NewThrottledTransport(time.Second/10, 100, http.DefaultTransport) // allows 10 requests every second //36000 per Hour
-	euBlizzClient, err := blizzard.NewClient(blizzard.Config{
-		ClientID:     goDotEnvVariable("CLIENT_ID"),
-		ClientSecret: goDotEnvVariable("CLIENT_SECRET"),
-		HTTPClient:   throttledClient,
-		Region:       blizzard.EU,
-		Locale:       blizzard.DeDE,
-	})
-	err = euBlizzClient.AccessTokenRequest(ctx)
+	blizzCache.load(app)
+	defer blizzCache.persist(app)
+
+	guilds, err := app.FindAllRecords("guilds", dbx.HashExp{"enabled": true})
 	if err != nil {
-		log.Println(err)
+		log.Printf("Error finding guilds: %v", err)
+		return
+	}
+	if len(guilds) == 0 {
+		log.Printf("No enabled guilds configured, nothing to update.")
+		return
+	}
+
+	localeClients := map[clientKey]*blizzard.Client{}
+	// recipes are the same in every region, they are resolved with the client of the first synced guild
+	var recipeClient *blizzard.Client
+	for _, guild := range guilds {
+		region, locale, err := parseRegion(guild.GetString("region"), guild.GetString("locale"))
+		if err != nil {
+			log.Printf("Skipping %s-%s: %v", guild.GetString("guild_slug"), guild.GetString("realm_slug"), err)
+			continue
+		}
+		client, err := getBlizzClient(ctx, region, locale)
+		if err != nil {
+			log.Printf("Skipping %s-%s: %v", guild.GetString("guild_slug"), guild.GetString("realm_slug"), err)
+			continue
+		}
+		localeClients[clientKey{region: region, locale: locale}] = client
+		for _, extraLocale := range guild.GetStringSlice("extra_locales") {
+			extraClient, err := getBlizzClient(ctx, region, blizzard.Locale(extraLocale))
+			if err != nil {
+				log.Printf("Skipping locale %s for %s-%s: %v", extraLocale, guild.GetString("guild_slug"), guild.GetString("realm_slug"), err)
+				continue
+			}
+			localeClients[clientKey{region: region, locale: blizzard.Locale(extraLocale)}] = extraClient
+		}
+		syncGuild(ctx, app, client, guild, runID)
+		if recipeClient == nil {
+			recipeClient = client
+		}
+	}
+
+	for key, client := range localeClients {
+		namesCtx, validators := withPendingValidators(ctx)
+		if err := syncLocalizedNames(namesCtx, app, client); err != nil {
+			log.Printf("Error updating %s/%s names: %v", key.region, key.locale, err)
+			continue
+		}
+		blizzCache.commit(validators)
 	}
-	roster, header, err := euBlizzClient.WoWGuildRoster(ctx, goDotEnvVariable("REALM_SLUG"), goDotEnvVariable("GUILD_SLUG"))
+	if recipeClient != nil {
+		resolveRecipes(ctx, app, recipeClient)
+	}
+	stats := blizzTransport.Stats()
+	log.Printf("Update and Cleanup done. Blizzard API: %d requests, %d retries, %s throttled.", stats.Requests, stats.Retries, stats.ThrottledTime)
+}
+
+// syncGuild updates the characters of a single tracked guild from its roster
+// and marks the characters of that guild which are no longer on it as left.
+func syncGuild(ctx context.Context, app core.App, client *blizzard.Client, guild *core.Record, runID string) {
+	realmSlug := guild.GetString("realm_slug")
+	guildSlug := guild.GetString("guild_slug")
+	log.Printf("Updating guild %s-%s...", guildSlug, realmSlug)
+
+	// the roster is always needed in full, the members are looked up from it
+	roster, header, err := client.WoWGuildRoster(withoutCache(ctx), realmSlug, guildSlug)
 	if err != nil {
 		log.Println(header)
 		log.Println(err)
+		return
 	}
 	collection, err := app.FindCollectionByNameOrId("characters")
 	if err != nil {
 		log.Printf("Error finding collection: %v", err)
+		return
 	}
 
-	records, err := app.FindAllRecords("characters")
+	records, err := app.FindAllRecords("characters", dbx.HashExp{"guild": guild.Id})
 	if err != nil {
 		log.Printf("Error finding records: %v", err)
 		return
@@ -198,124 +309,462 @@ func blizzClient(app *pocketbase.PocketBase) {
 		}
 	}
 
-	rosterKeys := make(map[string]struct{}, len(roster.Members))
-
+	members := make([]rosterMember, 0, len(roster.Members))
 	for _, member := range roster.Members {
-		maxRetries := 3
-		memberInfo, header, err := euBlizzClient.WoWCharacterProfileSummary(ctx, member.Character.Realm.Slug, member.Character.Name)
-		for attempt := 1; attempt < maxRetries && header == nil; attempt++ {
-			log.Printf("Attempt %d/%d: nil header for %s-%s, retrying...", attempt+1, maxRetries, member.Character.Name, member.Character.Realm.Slug)
-			time.Sleep(time.Duration(attempt) * time.Second / 10)
-			memberInfo, header, err = euBlizzClient.WoWCharacterProfileSummary(ctx, member.Character.Realm.Slug, member.Character.Name)
+		members = append(members, rosterMember{id: strconv.Itoa(member.Character.ID), name: member.Character.Name, realmSlug: member.Character.Realm.Slug, rank: member.Rank})
+	}
+	results := fetchMembers(withCollectionSettings(ctx, guild), client, members, existingRecords)
+	defer func() {
+		for _, result := range results {
+			if result != nil {
+				releaseCharacterData(result.data)
+			}
 		}
+	}()
+
+	// members that couldn't be fetched are still on the roster and must not be cleaned up
+	rosterKeys := make(map[string]struct{}, len(members))
+	for _, member := range members {
+		rosterKeys[member.id] = struct{}{}
+	}
+
+	// the writes run in transactions of SYNC_WRITE_CHUNK members (the whole roster by default), a chunk applies
+	// fully or not at all, so a crash mid-run never leaves a half-updated roster and subscribers only see committed
+	// changes. A failed chunk is rolled back and logged, the other chunks are still written.
+	chunkSize := envInt("SYNC_WRITE_CHUNK", 0)
+	if chunkSize <= 0 {
+		chunkSize = max(len(results), 1)
+	}
+	for start := 0; start < len(results); start += chunkSize {
+		chunk := results[start:min(start+chunkSize, len(results))]
+		// the cache validators of the chunk are only committed with its transaction, data that wasn't saved
+		// must be requested in full again instead of being answered with a 304 by the next run
+		var saved []*pendingValidators
+		err := app.RunInTransaction(func(txApp core.App) error {
+			saved = saved[:0]
+			for _, result := range chunk {
+				if result == nil {
+					continue
+				}
+				validators, err := writeMember(txApp, collection, guild, runID, existingRecords, result)
+				if err != nil {
+					return fmt.Errorf("writing %s-%s: %w", result.member.name, result.member.realmSlug, err)
+				}
+				saved = append(saved, validators...)
+			}
+			return nil
+		})
 		if err != nil {
-			log.Println("Response Header:", header)
-			log.Println(err)
+			log.Printf("Error writing members %d to %d of %s-%s: %v", start+1, start+len(chunk), guildSlug, realmSlug, err)
 			continue
 		}
-		if header == nil {
-			log.Printf("Skipping %s-%s: nil header after %d retries", member.Character.Name, member.Character.Realm.Slug, maxRetries)
-			continue
+		blizzCache.commit(saved...)
+	}
+
+	// the departures only depend on the roster, so they run in their own transaction even if a chunk failed:
+	// the members of a failed chunk are still on the roster and are not marked as departed
+	err = app.RunInTransaction(func(txApp core.App) error {
+		return markDepartedMembers(txApp, guild, runID, existingRecords, rosterKeys)
+	})
+	if err != nil {
+		log.Printf("Error cleaning up departed members of %s-%s: %v", guildSlug, realmSlug, err)
+	}
+	log.Printf("Update of %s-%s finished with %d members.", guildSlug, realmSlug, len(roster.Members))
+}
+
+// writeMember diffs and saves the fetched data of a single roster member and returns the cache validators
+// of the responses that were saved. Any failed write is returned, so the transaction of the chunk is rolled back.
+func writeMember(txApp core.App, collection *core.Collection, guild *core.Record, runID string, existingRecords map[string]*core.Record, result *memberResult) ([]*pendingValidators, error) {
+	guildSlug := guild.GetString("guild_slug")
+	realmSlug := guild.GetString("realm_slug")
+	storedRecord, stored := existingRecords[result.member.id]
+	wasMember := stored && storedRecord.GetString("status") != memberLeft
+	if result.notModified {
+		// profile unchanged since the last sync, skip the diff
+		if err := rejoinMember(txApp, storedRecord, runID); err != nil {
+			return nil, err
 		}
-		idValue := strconv.Itoa(memberInfo.ID)
-		rosterKeys[idValue] = struct{}{}
-		fieldValues := map[string]any{
-			"name":                        memberInfo.Name,
-			"realm":                       memberInfo.Realm.Slug,
-			"realm_name":                  memberInfo.Realm.Name,
-			"realm_id":                    memberInfo.Realm.ID,
-			"gender_type":                 memberInfo.Gender.Type,
-			"gender_name":                 memberInfo.Gender.Name,
-			"faction_type":                memberInfo.Faction.Type,
-			"faction_name":                memberInfo.Faction.Name,
-			"race_id":                     memberInfo.Race.ID,
-			"race_name":                   memberInfo.Race.Name,
-			"character_class_id":          memberInfo.CharacterClass.ID,
-			"character_class_name":        memberInfo.CharacterClass.Name,
-			"active_spec_id":              memberInfo.ActiveSpec.ID,
-			"active_spec_name":            memberInfo.ActiveSpec.Name,
-			"guild_name":                  memberInfo.Guild.Name,
-			"guild_id":                    memberInfo.Guild.ID,
-			"guild_realm_name":            memberInfo.Guild.Realm.Name,
-			"guild_realm_id":              memberInfo.Guild.Realm.ID,
-			"guild_realm_slug":            memberInfo.Guild.Realm.Slug,
-			"level":                       memberInfo.Level,
-			"experience":                  memberInfo.Experience,
-			"achievement_points":          memberInfo.AchievementPoints,
-			"last_login_timestamp":        memberInfo.LastLoginTimestamp,
-			"average_item_level":          memberInfo.AverageItemLevel,
-			"equipped_item_level":         memberInfo.EquippedItemLevel,
-			"active_title_id":             memberInfo.ActiveTitle.ID,
-			"active_title_name":           memberInfo.ActiveTitle.Name,
-			"active_title_display_string": memberInfo.ActiveTitle.DisplayString,
-		}
-		if record, ok := existingRecords[idValue]; ok {
-			// check if any field value has changed, if not skip update
-			same := true
-			for key, value := range fieldValues {
-				if normalizeValue(record.Get(key)) != normalizeValue(value) {
-					same = false
-					log.Printf("Field '%s' changed for %s-%s: '%v' -> '%v'", key, record.GetString("name"), record.GetString("realm_name"), normalizeValue(record.Get(key)), normalizeValue(value))
-					break
-				}
-			}
-			if same {
-				//log.Printf("Skipping update for %s-%s, no changes detected.", record.GetString("name"), record.GetString("realm_name"))
-				continue
-			}
+		if err := trackMembership(txApp, guild, storedRecord, result.member.rank, wasMember, runID); err != nil {
+			return nil, err
+		}
+		return saveCharacterData(txApp, storedRecord, result.data, runID)
+	}
+	memberInfo := result.info
+	idValue := strconv.Itoa(memberInfo.ID)
+	fieldValues := map[string]any{
+		"name":                        memberInfo.Name,
+		"realm":                       memberInfo.Realm.Slug,
+		"realm_name":                  memberInfo.Realm.Name,
+		"realm_id":                    memberInfo.Realm.ID,
+		"gender_type":                 memberInfo.Gender.Type,
+		"gender_name":                 memberInfo.Gender.Name,
+		"faction_type":                memberInfo.Faction.Type,
+		"faction_name":                memberInfo.Faction.Name,
+		"race_id":                     memberInfo.Race.ID,
+		"race_name":                   memberInfo.Race.Name,
+		"character_class_id":          memberInfo.CharacterClass.ID,
+		"character_class_name":        memberInfo.CharacterClass.Name,
+		"active_spec_id":              memberInfo.ActiveSpec.ID,
+		"active_spec_name":            memberInfo.ActiveSpec.Name,
+		"guild_name":                  memberInfo.Guild.Name,
+		"guild_id":                    memberInfo.Guild.ID,
+		"guild_realm_name":            memberInfo.Guild.Realm.Name,
+		"guild_realm_id":              memberInfo.Guild.Realm.ID,
+		"guild_realm_slug":            memberInfo.Guild.Realm.Slug,
+		"guild":                       guild.Id,
+		"region":                      guild.GetString("region"),
+		"level":                       memberInfo.Level,
+		"experience":                  memberInfo.Experience,
+		"achievement_points":          memberInfo.AchievementPoints,
+		"last_login_timestamp":        memberInfo.LastLoginTimestamp,
+		"average_item_level":          memberInfo.AverageItemLevel,
+		"equipped_item_level":         memberInfo.EquippedItemLevel,
+		"active_title_id":             memberInfo.ActiveTitle.ID,
+		"active_title_name":           memberInfo.ActiveTitle.Name,
+		"active_title_display_string": memberInfo.ActiveTitle.DisplayString,
+	}
+	var err error
+	record, ok := existingRecords[idValue]
+	if ok {
+		// check if any field value has changed, if not skip update
+		changes := diffRecordFields(record, fieldValues)
+		for _, change := range changes {
+			log.Printf("Field '%s' changed for %s-%s: '%v' -> '%v'", change.field, record.GetString("name"), record.GetString("realm_name"), change.oldValue, change.newValue)
+		}
+		if len(changes) > 0 {
 			setRecordFields(record, collection, fieldValues)
-			err = app.Save(record)
+			err = txApp.Save(record)
 			if err != nil {
-				log.Printf("Error updating record for %s-%s: %v", memberInfo.Name, memberInfo.Realm.Name, err)
-			} else {
-				//log.Printf("Updated record for %s-%s", memberInfo.Name, memberInfo.Realm.Name)
+				return nil, fmt.Errorf("updating record: %w", err)
 			}
-		} else {
-			record := core.NewRecord(collection)
-			record.Id = idValue
-			setRecordFields(record, collection, fieldValues)
-			err = app.Save(record)
-			if err != nil {
-				log.Printf("Error inserting record for %s-%s: %v", memberInfo.Name, memberInfo.Realm.Name, err)
-			} else {
-				//log.Printf("Inserted record for %s-%s", memberInfo.Name, memberInfo.Realm.Name)
+			//log.Printf("Updated record for %s-%s", memberInfo.Name, memberInfo.Realm.Name)
+			if err := saveHistory(txApp, record.Id, runID, changes); err != nil {
+				return nil, err
+			}
+		}
+	} else if record, err = txApp.FindRecordById("characters", idValue); err == nil {
+		// the character moved over from another tracked guild
+		previousGuild := record.GetString("guild")
+		changes := diffRecordFields(record, fieldValues)
+		setRecordFields(record, collection, fieldValues)
+		err = txApp.Save(record)
+		if err != nil {
+			return nil, fmt.Errorf("moving record: %w", err)
+		}
+		log.Printf("Moved record for %s-%s to %s-%s", memberInfo.Name, memberInfo.Realm.Name, guildSlug, realmSlug)
+		if err := saveHistory(txApp, record.Id, runID, changes); err != nil {
+			return nil, err
+		}
+		if previousGuild != "" && record.GetString("status") != memberLeft {
+			if err := saveMembershipEvent(txApp, previousGuild, record, eventLeave, record.GetInt("rank"), unknownRank, runID); err != nil {
+				return nil, err
 			}
 		}
+	} else {
+		record = core.NewRecord(collection)
+		record.Id = idValue
+		record.Set("status", memberActive)
+		record.Set("rank", result.member.rank)
+		setRecordFields(record, collection, fieldValues)
+		err = txApp.Save(record)
+		if err != nil {
+			return nil, fmt.Errorf("inserting record: %w", err)
+		}
+		//log.Printf("Inserted record for %s-%s", memberInfo.Name, memberInfo.Realm.Name)
+	}
+	if err := rejoinMember(txApp, record, runID); err != nil {
+		return nil, err
 	}
-	log.Printf("Update finished with %d members.", len(roster.Members))
-	log.Printf("Deleting old records...")
+	if err := trackMembership(txApp, guild, record, result.member.rank, wasMember, runID); err != nil {
+		return nil, err
+	}
+	saved, err := saveCharacterData(txApp, record, result.data, runID)
+	if err != nil {
+		return nil, err
+	}
+	return append(saved, result.validators), nil
+}
+
+// member status values of the "characters" collection.
+const (
+	memberActive = "active"
+	memberLeft   = "left"
+)
+
+// markDepartedMembers soft-deletes the characters of a guild that are no longer on its roster by setting
+// their status to "left", and deletes characters that have been gone for longer than SYNC_LEAVE_GRACE_DAYS (defaults to 14).
+// Departures that look like an incomplete roster are held back by departuresConfirmed.
+func markDepartedMembers(txApp core.App, guild *core.Record, runID string, existingRecords map[string]*core.Record, rosterKeys map[string]struct{}) error {
+	guildName := guild.GetString("guild_slug") + "-" + guild.GetString("realm_slug")
+	active := 0
+	var departed []*core.Record
 	for key, record := range existingRecords {
+		if record.GetString("status") == memberLeft {
+			continue
+		}
+		active++
 		if _, ok := rosterKeys[key]; !ok {
-			err := app.Delete(record)
-			if err != nil {
-				log.Printf("Error deleting record: %v", err)
-			} else {
-				log.Printf("Deleted record for %s-%s", record.GetString("name"), record.GetString("realm_name"))
-			}
+			departed = append(departed, record)
+		}
+	}
+	confirmed, err := departuresConfirmed(txApp, guild, departed, active)
+	if err != nil || !confirmed {
+		return err
+	}
+
+	log.Printf("Cleaning up departed members...")
+	now := types.NowDateTime()
+	for _, record := range departed {
+		record.Set("status", memberLeft)
+		record.Set("left_at", now)
+		if err := txApp.Save(record); err != nil {
+			return fmt.Errorf("marking %s-%s as left: %w", record.GetString("name"), record.GetString("realm_name"), err)
 		}
+		log.Printf("%s-%s left %s", record.GetString("name"), record.GetString("realm_name"), guildName)
+		if err := saveMembershipEvent(txApp, guild.Id, record, eventLeave, record.GetInt("rank"), unknownRank, runID); err != nil {
+			return err
+		}
+	}
+
+	cutoff := now.AddDate(0, 0, -envInt("SYNC_LEAVE_GRACE_DAYS", 14))
+	for key, record := range existingRecords {
+		if _, ok := rosterKeys[key]; ok || record.GetString("status") != memberLeft {
+			continue
+		}
+		if leftAt := record.GetDateTime("left_at"); leftAt.IsZero() || leftAt.After(cutoff) {
+			continue
+		}
+		if err := txApp.Delete(record); err != nil {
+			return fmt.Errorf("deleting %s-%s: %w", record.GetString("name"), record.GetString("realm_name"), err)
+		}
+		log.Printf("Deleted record for %s-%s", record.GetString("name"), record.GetString("realm_name"))
+	}
+	return nil
+}
+
+// departuresConfirmed guards against an incomplete roster: if more than SYNC_MAX_DEPARTED_PERCENT (defaults to 25)
+// of the active members would leave in a single run, and more than SYNC_MIN_DEPARTED (defaults to 3) members, the
+// departures are held back. They are applied once the same members have been missing for SYNC_DEPARTED_CONFIRM_RUNS
+// runs (defaults to 6) or a superuser sets "confirm_departures" on the guild.
+func departuresConfirmed(txApp core.App, guild *core.Record, departed []*core.Record, active int) (bool, error) {
+	guildName := guild.GetString("guild_slug") + "-" + guild.GetString("realm_slug")
+	// the guild is reloaded, a superuser may have confirmed the departures since the run started
+	guild, err := txApp.FindRecordById("guilds", guild.Id)
+	if err != nil {
+		return false, err
+	}
+	maxPercent := envInt("SYNC_MAX_DEPARTED_PERCENT", 25)
+	guarded := len(departed) > envInt("SYNC_MIN_DEPARTED", 3) && len(departed)*100 > active*maxPercent
+
+	ids := make([]string, 0, len(departed))
+	for _, record := range departed {
+		ids = append(ids, record.Id)
+	}
+	sort.Strings(ids)
+	var previous []string
+	guild.UnmarshalJSONField("blocked_departures", &previous)
+	if !guarded && len(previous) == 0 && !guild.GetBool("confirm_departures") {
+		return true, nil
+	}
+
+	// the run counts on while the members blocked before are still missing, others coming back
+	// or going missing on top don't reset it
+	runs := 1
+	stillMissing := len(previous) > 0
+	for _, id := range previous {
+		if _, ok := slices.BinarySearch(ids, id); !ok {
+			stillMissing = false
+			break
+		}
+	}
+	if stillMissing {
+		runs = guild.GetInt("blocked_departure_runs") + 1
+	}
+
+	confirmed := true
+	switch confirmRuns := envInt("SYNC_DEPARTED_CONFIRM_RUNS", 6); {
+	case !guarded:
+	case guild.GetBool("confirm_departures"):
+		log.Printf("Departures of %s confirmed by a superuser: %d of %d members leave.", guildName, len(departed), active)
+	case runs >= confirmRuns:
+		log.Printf("Departures of %s confirmed: %d of %d members have been missing for %d runs.", guildName, len(departed), active, runs)
+	default:
+		log.Printf("Skipping cleanup of %s: %d of %d members would leave, more than %d%% (run %d of %d, set confirm_departures on the guild to apply it now).", guildName, len(departed), active, maxPercent, runs, confirmRuns)
+		confirmed = false
+	}
+
+	fields := map[string]any{"blocked_departures": nil, "blocked_departure_runs": 0, "confirm_departures": false}
+	if !confirmed {
+		fields["blocked_departures"], fields["blocked_departure_runs"] = ids, runs
+	}
+	setRecordFields(guild, guild.Collection(), fields)
+	if err := txApp.Save(guild); err != nil {
+		return false, fmt.Errorf("saving departure guard: %w", err)
+	}
+	return confirmed, nil
+}
+
+// rejoinMember reactivates a character that left a guild and is back on a roster.
+func rejoinMember(txApp core.App, record *core.Record, runID string) error {
+	previous := record.GetString("status")
+	if previous == memberActive {
+		return nil
+	}
+	record.Set("status", memberActive)
+	record.Set("left_at", "")
+	if err := txApp.Save(record); err != nil {
+		return fmt.Errorf("reactivating record: %w", err)
+	}
+	if previous != memberLeft {
+		return nil
+	}
+	log.Printf("%s-%s rejoined", record.GetString("name"), record.GetString("realm_name"))
+	return saveHistory(txApp, record.Id, runID, []fieldChange{{field: "status", oldValue: previous, newValue: memberActive}})
+}
+
+// rosterMember is a character listed on a guild roster.
+type rosterMember struct {
+	id        string
+	name      string
+	realmSlug string
+	rank      int
+}
+
+type rosterMemberKey struct{}
+
+// withRosterMember passes the roster entry of the fetched member to the character syncs using the returned context.
+func withRosterMember(ctx context.Context, member rosterMember) context.Context {
+	return context.WithValue(ctx, rosterMemberKey{}, member)
+}
+
+// memberResult is the fetched data of a roster member, written once all members have been fetched.
+type memberResult struct {
+	member      rosterMember
+	notModified bool
+	info        *wowp.CharacterProfileSummary
+	data        []characterData
+	validators  *pendingValidators // of the profile summary
+}
+
+// fetchMembers fetches the roster members with a bounded pool of SYNC_CONCURRENCY workers (defaults to 4).
+// All workers share the throttled transport, so the rate limit holds regardless of the concurrency.
+// The results are in roster order, members that couldn't be fetched are nil.
+func fetchMembers(ctx context.Context, client *blizzard.Client, members []rosterMember, existingRecords map[string]*core.Record) []*memberResult {
+	results := make([]*memberResult, len(members))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(envInt("SYNC_CONCURRENCY", 4), 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				memberCtx := withRosterMember(ctx, members[i])
+				record, stored := existingRecords[members[i].id]
+				if stored {
+					memberCtx = withStoredMedia(memberCtx, record)
+				}
+				results[i] = fetchMember(memberCtx, client, members[i], stored)
+			}
+		}()
 	}
-	log.Printf("Update and Cleanup done.")
+	for i := range members {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// fetchMember fetches the profile summary and the registered character syncs of a single roster member.
+func fetchMember(ctx context.Context, client *blizzard.Client, member rosterMember, stored bool) *memberResult {
+	// conditional requests only make sense for characters we already have stored
+	memberCtx := ctx
+	if !stored {
+		memberCtx = withoutCache(ctx)
+	}
+
+	// 429 and 5xx responses are already retried by the ThrottledTransport, a member that still
+	// fails is skipped and picked up again by the next run
+	profileCtx, validators := withPendingValidators(memberCtx)
+	memberInfo, header, err := client.WoWCharacterProfileSummary(profileCtx, member.realmSlug, member.name)
+	result := &memberResult{member: member, validators: validators}
+	switch {
+	case errors.Is(err, errNotModified):
+		result.notModified = true
+	case err != nil:
+		log.Println("Response Header:", header)
+		log.Printf("Skipping %s-%s: %v", member.name, member.realmSlug, err)
+		return nil
+	default:
+		result.info = memberInfo
+	}
+	result.data = fetchCharacterData(memberCtx, client, member.realmSlug, member.name)
+	return result
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == rolloutCommand {
+		os.Exit(runRollout(os.Args[2:]))
+	}
+
 	app := pocketbase.New()
 	// runs the "Update" task every 7 minutes
 	app.Cron().MustAdd("Update", "*/7 * * * *", func() {
 		blizzClient(app)
 	})
 
-	// checks for new container image every 20 minutes (watchtower-like)
-	app.Cron().MustAdd("SelfUpdate", "*/20 * * * *", func() {
-		watchForUpdates()
+	// refreshes the guild profiles, crests and achievements every hour, at startup and for newly added guilds
+	app.Cron().MustAdd("GuildProfile", "0 * * * *", func() {
+		syncGuildProfiles(app)
+	})
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		go syncGuildProfiles(app)
+		return se.Next()
+	})
+	app.OnRecordAfterCreateSuccess("guilds").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetBool("enabled") {
+			go syncNewGuildProfile(e.App, e.Record.Clone())
+		}
+		return e.Next()
+	})
+
+	// checks for new container images on the schedule of the "selfupdate_settings" record (defaults to every 20 minutes)
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		scheduleSelfUpdate(app)
+		return se.Next()
+	})
+	app.OnRecordAfterUpdateSuccess("selfupdate_settings").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetString("schedule") != e.Record.Original().GetString("schedule") {
+			scheduleSelfUpdate(e.App)
+		}
+		return e.Next()
 	})
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
 		// serves static files from the provided public dir (if exists)
 		se.Router.GET("/{path...}", apis.Static(os.DirFS("./pb_public"), false))
+		se.Router.GET("/api/blizbase/characters/{id}/history", characterHistory)
+		se.Router.GET("/api/blizbase/mythic-plus/leaderboard", mythicPlusLeaderboard)
+		se.Router.GET("/api/blizbase/guilds/{id}/progression", guildProgression)
+		se.Router.GET("/api/blizbase/guilds/{id}/activity", guildActivity)
+		se.Router.GET("/api/blizbase/guilds/{id}/renown", guildRenown)
+		se.Router.GET("/api/blizbase/guilds/{id}/achievements", guildAchievements)
+		se.Router.GET("/api/blizbase/professions/crafters", professionCrafters)
+		se.Router.GET("/api/blizbase/collections/missing", collectionMissing)
+		se.Router.GET("/api/blizbase/health", healthCheck)
+		se.Router.POST("/api/blizbase/selfupdate/events/{id}/result", rolloutResultHandler)
+		se.Router.GET("/api/blizbase/selfupdate", selfUpdateStatus).Bind(apis.RequireSuperuserAuth())
+		se.Router.POST("/api/blizbase/selfupdate/check", selfUpdateCheck).Bind(apis.RequireSuperuserAuth())
+		se.Router.POST("/api/blizbase/selfupdate/update", selfUpdateNow).Bind(apis.RequireSuperuserAuth())
+		se.Router.PATCH("/api/blizbase/selfupdate/settings", selfUpdateSettings).Bind(apis.RequireSuperuserAuth())
+		se.Router.GET("/api/blizbase/stats", func(e *core.RequestEvent) error {
+			return e.JSON(http.StatusOK, blizzTransport.Stats())
+		}).Bind(apis.RequireSuperuserAuth())
 
 		return se.Next()
 	})
 
 	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		failStaleRollouts(app)
 		total, err := app.CountRecords("characters")
 		if total == 0 {
 			log.Printf("No records found, starting initial update...")
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// event values of the "guild_membership_events" collection.
+const (
+	eventJoin    = "join"
+	eventLeave   = "leave"
+	eventPromote = "promote"
+	eventDemote  = "demote"
+)
+
+// unknownRank is the rank of characters stored before ranks were synced and the rank
+// outside of the guild on join and leave events, rank 0 is the guild master.
+const unknownRank = -1
+
+// saveMembershipEvent records a roster change of a character in the "guild_membership_events" collection.
+func saveMembershipEvent(app core.App, guildID string, character *core.Record, event string, oldRank, newRank int, runID string) error {
+	collection, err := app.FindCollectionByNameOrId("guild_membership_events")
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("guild", guildID)
+	record.Set("character", character.Id)
+	record.Set("character_name", character.GetString("name"))
+	record.Set("realm", character.GetString("realm"))
+	record.Set("event", event)
+	record.Set("old_rank", oldRank)
+	record.Set("new_rank", newRank)
+	record.Set("sync_run", runID)
+	if err := app.Save(record); err != nil {
+		return fmt.Errorf("saving %s event: %w", event, err)
+	}
+	return nil
+}
+
+// trackMembership stores the roster rank of a saved character and records a join event
+// if it wasn't an active member of the guild before, or a promotion or demotion if its rank changed.
+// Lower ranks are higher in the guild hierarchy.
+func trackMembership(txApp core.App, guild *core.Record, character *core.Record, rank int, wasMember bool, runID string) error {
+	oldRank := character.GetInt("rank")
+	var err error
+	switch {
+	case !wasMember:
+		err = saveMembershipEvent(txApp, guild.Id, character, eventJoin, unknownRank, rank, runID)
+	case oldRank == unknownRank || oldRank == rank:
+	case rank < oldRank:
+		err = saveMembershipEvent(txApp, guild.Id, character, eventPromote, oldRank, rank, runID)
+	default:
+		err = saveMembershipEvent(txApp, guild.Id, character, eventDemote, oldRank, rank, runID)
+	}
+	if err != nil || oldRank == rank {
+		return err
+	}
+	character.Set("rank", rank)
+	if err := txApp.Save(character); err != nil {
+		return fmt.Errorf("saving rank: %w", err)
+	}
+	return nil
+}
+
+// guildActivity returns the recent roster activity of a guild, newest first.
+// The optional "days" query parameter sets how far back to look (defaults to 30).
+func guildActivity(e *core.RequestEvent) error {
+	guild, err := e.App.FindRecordById("guilds", e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Guild not found.", err)
+	}
+	days, err := queryDays(e, 30)
+	if err != nil {
+		return err
+	}
+	since := types.NowDateTime().AddDate(0, 0, -days)
+
+	records, err := e.App.FindRecordsByFilter("guild_membership_events", "guild = {:guild} && created >= {:since}", "-created", 0, 0, dbx.Params{"guild": guild.Id, "since": since.String()})
+	if err != nil {
+		return e.InternalServerError("Failed to load the roster activity.", err)
+	}
+
+	type entry struct {
+		Character string `json:"character"`
+		Name      string `json:"name"`
+		Realm     string `json:"realm"`
+		Event     string `json:"event"`
+		OldRank   int    `json:"old_rank"`
+		NewRank   int    `json:"new_rank"`
+		Created   string `json:"created"`
+	}
+	activity := make([]entry, 0, len(records))
+	for _, record := range records {
+		activity = append(activity, entry{
+			Character: record.GetString("character"),
+			Name:      record.GetString("character_name"),
+			Realm:     record.GetString("realm"),
+			Event:     record.GetString("event"),
+			OldRank:   record.GetInt("old_rank"),
+			NewRank:   record.GetInt("new_rank"),
+			Created:   record.GetString("created"),
+		})
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"guild":    guild.Id,
+		"days":     days,
+		"activity": activity,
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the "guilds" collection holding the tracked guilds and links every
+// character to the guild it was synced from.
+func init() {
+	migrations.Register(func(app core.App) error {
+		guilds := core.NewBaseCollection("guilds")
+		guilds.ViewRule = types.Pointer("")
+		guilds.ListRule = types.Pointer("")
+		guilds.Fields.Add(&core.SelectField{Name: "region", Values: []string{"us", "eu", "kr", "tw", "cn"}, MaxSelect: 1, Required: true})
+		guilds.Fields.Add(&core.TextField{Name: "realm_slug", Required: true})
+		guilds.Fields.Add(&core.TextField{Name: "guild_slug", Required: true})
+		guilds.Fields.Add(&core.BoolField{Name: "enabled"})
+		guilds.AddIndex("idx_guilds_region_realm_guild", true, "region, realm_slug, guild_slug", "")
+		if err := app.Save(guilds); err != nil {
+			return err
+		}
+
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		characters.Fields.Add(&core.RelationField{Name: "guild", CollectionId: guilds.Id, MaxSelect: 1, CascadeDelete: true})
+		if err := app.Save(characters); err != nil {
+			return err
+		}
+
+		// seed the guild previously configured through the environment so
+		// existing single guild setups keep working without manual steps
+		realmSlug := goDotEnvVariable("REALM_SLUG")
+		guildSlug := goDotEnvVariable("GUILD_SLUG")
+		if realmSlug == "" || guildSlug == "" {
+			return nil
+		}
+		guild := core.NewRecord(guilds)
+		guild.Set("region", "eu")
+		guild.Set("realm_slug", realmSlug)
+		guild.Set("guild_slug", guildSlug)
+		guild.Set("enabled", true)
+		if err := app.Save(guild); err != nil {
+			return err
+		}
+
+		_, err = app.DB().Update("characters", dbx.Params{"guild": guild.Id}, dbx.HashExp{"guild": ""}).Execute()
+		return err
+	}, func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		characters.Fields.RemoveByName("guild")
+		if err := app.Save(characters); err != nil {
+			return err
+		}
+
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return nil // probably already deleted
+		}
+		return app.Delete(guilds)
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the locale configuration to the tracked guilds and the "localized_names"
+// collection holding race, class, spec and title names for additional locales.
+func init() {
+	migrations.Register(func(app core.App) error {
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return err
+		}
+		guilds.Fields.Add(&core.SelectField{Name: "locale", Values: allLocales, MaxSelect: 1})
+		guilds.Fields.Add(&core.SelectField{Name: "extra_locales", Values: allLocales, MaxSelect: len(allLocales)})
+		if err := app.Save(guilds); err != nil {
+			return err
+		}
+		// names have been stored in german so far, keep it that way for existing guilds
+		if _, err := app.DB().Update("guilds", dbx.Params{"locale": "de_DE"}, dbx.HashExp{"region": "eu", "locale": ""}).Execute(); err != nil {
+			return err
+		}
+
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		characters.Fields.Add(&core.TextField{Name: "region"})
+		if err := app.Save(characters); err != nil {
+			return err
+		}
+		if _, err := app.DB().Update("characters", dbx.Params{"region": "eu"}, dbx.HashExp{"region": ""}).Execute(); err != nil {
+			return err
+		}
+
+		names := core.NewBaseCollection("localized_names")
+		names.ViewRule = types.Pointer("")
+		names.ListRule = types.Pointer("")
+		names.Fields.Add(&core.SelectField{Name: "kind", Values: []string{"race", "class", "spec", "title"}, MaxSelect: 1, Required: true})
+		names.Fields.Add(&core.NumberField{Name: "game_id", OnlyInt: true})
+		names.Fields.Add(&core.SelectField{Name: "locale", Values: allLocales, MaxSelect: 1, Required: true})
+		names.Fields.Add(&core.TextField{Name: "name"})
+		names.AddIndex("idx_localized_names_kind_game_id_locale", true, "kind, game_id, locale", "")
+		return app.Save(names)
+	}, func(app core.App) error {
+		if names, err := app.FindCollectionByNameOrId("localized_names"); err == nil {
+			if err := app.Delete(names); err != nil {
+				return err
+			}
+		}
+
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		characters.Fields.RemoveByName("region")
+		if err := app.Save(characters); err != nil {
+			return err
+		}
+
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return err
+		}
+		guilds.Fields.RemoveByName("locale")
+		guilds.Fields.RemoveByName("extra_locales")
+		return app.Save(guilds)
+	})
+}
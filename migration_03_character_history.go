@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the "character_history" collection recording every detected field change of a character.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+
+		history := core.NewBaseCollection("character_history")
+		history.ViewRule = types.Pointer("")
+		history.ListRule = types.Pointer("")
+		history.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		history.Fields.Add(&core.TextField{Name: "field", Required: true})
+		history.Fields.Add(&core.TextField{Name: "old_value"})
+		history.Fields.Add(&core.TextField{Name: "new_value"})
+		history.Fields.Add(&core.TextField{Name: "sync_run"})
+		history.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		history.AddIndex("idx_character_history_character_field", false, "character, field, created", "")
+		return app.Save(history)
+	}, func(app core.App) error {
+		history, err := app.FindCollectionByNameOrId("character_history")
+		if err != nil {
+			return nil // probably already deleted
+		}
+		return app.Delete(history)
+	})
+}
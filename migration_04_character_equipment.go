@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the "character_equipment" collection holding the equipped item of every slot of a character.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+
+		equipment := core.NewBaseCollection("character_equipment")
+		equipment.ViewRule = types.Pointer("")
+		equipment.ListRule = types.Pointer("")
+		equipment.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		equipment.Fields.Add(&core.TextField{Name: "slot", Required: true})
+		equipment.Fields.Add(&core.TextField{Name: "slot_name"})
+		equipment.Fields.Add(&core.NumberField{Name: "item_id"})
+		equipment.Fields.Add(&core.TextField{Name: "name"})
+		equipment.Fields.Add(&core.NumberField{Name: "item_level"})
+		equipment.Fields.Add(&core.TextField{Name: "quality"})
+		equipment.Fields.Add(&core.JSONField{Name: "enchantments"})
+		equipment.Fields.Add(&core.JSONField{Name: "gems"})
+		equipment.Fields.Add(&core.NumberField{Name: "sockets"})
+		equipment.Fields.Add(&core.NumberField{Name: "empty_sockets"})
+		equipment.Fields.Add(&core.TextField{Name: "set_name"})
+		equipment.Fields.Add(&core.JSONField{Name: "set_bonuses"})
+		equipment.AddIndex("idx_character_equipment_character_slot", true, "character, slot", "")
+		return app.Save(equipment)
+	}, func(app core.App) error {
+		equipment, err := app.FindCollectionByNameOrId("character_equipment")
+		if err != nil {
+			return nil // probably already deleted
+		}
+		return app.Delete(equipment)
+	})
+}
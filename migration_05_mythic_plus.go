@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the "mythic_plus_profiles" collection with the current season rating of a character
+// and the "mythic_plus_runs" collection with its best run per dungeon.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+
+		profiles := core.NewBaseCollection("mythic_plus_profiles")
+		profiles.ViewRule = types.Pointer("")
+		profiles.ListRule = types.Pointer("")
+		profiles.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		profiles.Fields.Add(&core.NumberField{Name: "season_id", OnlyInt: true})
+		profiles.Fields.Add(&core.NumberField{Name: "rating"})
+		profiles.Fields.Add(&core.TextField{Name: "rating_color"})
+		profiles.AddIndex("idx_mythic_plus_profiles_character_season", true, "character, season_id", "")
+		profiles.AddIndex("idx_mythic_plus_profiles_rating", false, "rating", "")
+		if err := app.Save(profiles); err != nil {
+			return err
+		}
+
+		runs := core.NewBaseCollection("mythic_plus_runs")
+		runs.ViewRule = types.Pointer("")
+		runs.ListRule = types.Pointer("")
+		runs.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		runs.Fields.Add(&core.NumberField{Name: "season_id", OnlyInt: true})
+		runs.Fields.Add(&core.NumberField{Name: "dungeon_id", OnlyInt: true})
+		runs.Fields.Add(&core.TextField{Name: "dungeon_name"})
+		runs.Fields.Add(&core.NumberField{Name: "keystone_level", OnlyInt: true})
+		runs.Fields.Add(&core.NumberField{Name: "duration", OnlyInt: true})
+		runs.Fields.Add(&core.BoolField{Name: "timed"})
+		runs.Fields.Add(&core.NumberField{Name: "completed_timestamp", OnlyInt: true})
+		runs.Fields.Add(&core.NumberField{Name: "rating"})
+		runs.Fields.Add(&core.TextField{Name: "rating_color"})
+		runs.Fields.Add(&core.JSONField{Name: "affixes"})
+		runs.Fields.Add(&core.JSONField{Name: "members"})
+		runs.AddIndex("idx_mythic_plus_runs_character_dungeon", true, "character, dungeon_id", "")
+		return app.Save(runs)
+	}, func(app core.App) error {
+		for _, name := range []string{"mythic_plus_runs", "mythic_plus_profiles"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue // probably already deleted
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the "raid_kills" collection with the boss kills of a character per raid and difficulty.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+
+		kills := core.NewBaseCollection("raid_kills")
+		kills.ViewRule = types.Pointer("")
+		kills.ListRule = types.Pointer("")
+		kills.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		kills.Fields.Add(&core.TextField{Name: "encounter_key", Required: true})
+		kills.Fields.Add(&core.NumberField{Name: "expansion_id", OnlyInt: true})
+		kills.Fields.Add(&core.TextField{Name: "expansion_name"})
+		kills.Fields.Add(&core.NumberField{Name: "instance_id", OnlyInt: true})
+		kills.Fields.Add(&core.TextField{Name: "instance_name"})
+		kills.Fields.Add(&core.TextField{Name: "difficulty"})
+		kills.Fields.Add(&core.TextField{Name: "difficulty_name"})
+		kills.Fields.Add(&core.NumberField{Name: "encounter_id", OnlyInt: true})
+		kills.Fields.Add(&core.TextField{Name: "encounter_name"})
+		kills.Fields.Add(&core.NumberField{Name: "total_count", OnlyInt: true})
+		kills.Fields.Add(&core.NumberField{Name: "completed_count", OnlyInt: true})
+		kills.Fields.Add(&core.NumberField{Name: "last_kill_timestamp", OnlyInt: true})
+		kills.Fields.Add(&core.NumberField{Name: "first_seen_kill_timestamp", OnlyInt: true})
+		kills.AddIndex("idx_raid_kills_character_encounter", true, "character, encounter_key", "")
+		return app.Save(kills)
+	}, func(app core.App) error {
+		kills, err := app.FindCollectionByNameOrId("raid_kills")
+		if err != nil {
+			return nil // probably already deleted
+		}
+		return app.Delete(kills)
+	})
+}
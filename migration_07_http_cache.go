@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+)
+
+// adds the "http_cache" collection persisting the ETag and Last-Modified validators of Blizzard API responses.
+func init() {
+	migrations.Register(func(app core.App) error {
+		cache := core.NewBaseCollection("http_cache")
+		cache.Fields.Add(&core.TextField{Name: "key", Required: true})
+		cache.Fields.Add(&core.TextField{Name: "etag"})
+		cache.Fields.Add(&core.TextField{Name: "last_modified"})
+		cache.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		cache.AddIndex("idx_http_cache_key", true, "key", "")
+		return app.Save(cache)
+	}, func(app core.App) error {
+		cache, err := app.FindCollectionByNameOrId("http_cache")
+		if err != nil {
+			return nil // probably already deleted
+		}
+		return app.Delete(cache)
+	})
+}
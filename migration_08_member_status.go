@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+)
+
+// adds the "status" and "left_at" fields to the characters, departed members
+// are kept as "left" for a grace period instead of being deleted right away.
+// The guilds get the fields of the departure guard: the members whose departure was blocked
+// by SYNC_MAX_DEPARTED_PERCENT, for how many runs they have been missing and a manual confirmation.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		characters.Fields.Add(&core.SelectField{Name: "status", Values: []string{memberActive, memberLeft}, MaxSelect: 1})
+		characters.Fields.Add(&core.DateField{Name: "left_at"})
+		if err := app.Save(characters); err != nil {
+			return err
+		}
+		if _, err := app.DB().Update("characters", dbx.Params{"status": memberActive}, dbx.HashExp{"status": ""}).Execute(); err != nil {
+			return err
+		}
+
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return err
+		}
+		guilds.Fields.Add(&core.JSONField{Name: "blocked_departures"})
+		guilds.Fields.Add(&core.NumberField{Name: "blocked_departure_runs", OnlyInt: true})
+		guilds.Fields.Add(&core.BoolField{Name: "confirm_departures"})
+		return app.Save(guilds)
+	}, func(app core.App) error {
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"blocked_departures", "blocked_departure_runs", "confirm_departures"} {
+			guilds.Fields.RemoveByName(name)
+		}
+		if err := app.Save(guilds); err != nil {
+			return err
+		}
+
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		characters.Fields.RemoveByName("status")
+		characters.Fields.RemoveByName("left_at")
+		return app.Save(characters)
+	})
+}
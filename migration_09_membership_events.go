@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the guild rank to the characters and the "guild_membership_events" collection
+// recording joins, leaves, promotions and demotions derived from consecutive rosters.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		characters.Fields.Add(&core.NumberField{Name: "rank", OnlyInt: true})
+		if err := app.Save(characters); err != nil {
+			return err
+		}
+		// the rank of existing characters is unknown until the next sync, which must not report it as a promotion
+		if _, err := app.DB().Update("characters", dbx.Params{"rank": unknownRank}, nil).Execute(); err != nil {
+			return err
+		}
+
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return err
+		}
+		events := core.NewBaseCollection("guild_membership_events")
+		events.ViewRule = types.Pointer("")
+		events.ListRule = types.Pointer("")
+		events.Fields.Add(&core.RelationField{Name: "guild", CollectionId: guilds.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		// not cascading, the events outlive the deleted records of departed members
+		events.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1})
+		events.Fields.Add(&core.TextField{Name: "character_name"})
+		events.Fields.Add(&core.TextField{Name: "realm"})
+		events.Fields.Add(&core.SelectField{Name: "event", Values: []string{eventJoin, eventLeave, eventPromote, eventDemote}, MaxSelect: 1, Required: true})
+		// the rank outside of the guild (old_rank of joins, new_rank of leaves) is unknownRank, 0 is the guild master
+		events.Fields.Add(&core.NumberField{Name: "old_rank", OnlyInt: true})
+		events.Fields.Add(&core.NumberField{Name: "new_rank", OnlyInt: true})
+		events.Fields.Add(&core.TextField{Name: "sync_run"})
+		events.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		events.AddIndex("idx_guild_membership_events_guild_created", false, "guild, created", "")
+		return app.Save(events)
+	}, func(app core.App) error {
+		if events, err := app.FindCollectionByNameOrId("guild_membership_events"); err == nil {
+			if err := app.Delete(events); err != nil {
+				return err
+			}
+		}
+
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		characters.Fields.RemoveByName("rank")
+		return app.Save(characters)
+	})
+}
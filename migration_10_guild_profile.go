@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+)
+
+// adds the guild profile, crest and achievement fields to the tracked guilds.
+func init() {
+	migrations.Register(func(app core.App) error {
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return err
+		}
+		guilds.Fields.Add(&core.TextField{Name: "name"})
+		guilds.Fields.Add(&core.TextField{Name: "faction_type"})
+		guilds.Fields.Add(&core.TextField{Name: "faction_name"})
+		guilds.Fields.Add(&core.NumberField{Name: "member_count", OnlyInt: true})
+		guilds.Fields.Add(&core.NumberField{Name: "achievement_points", OnlyInt: true})
+		guilds.Fields.Add(&core.NumberField{Name: "achievement_count", OnlyInt: true})
+		guilds.Fields.Add(&core.NumberField{Name: "created_timestamp", OnlyInt: true})
+		guilds.Fields.Add(&core.JSONField{Name: "crest"})
+		guilds.Fields.Add(&core.URLField{Name: "crest_emblem_url"})
+		guilds.Fields.Add(&core.URLField{Name: "crest_border_url"})
+		guilds.Fields.Add(&core.JSONField{Name: "recent_achievements"})
+		guilds.Fields.Add(&core.DateField{Name: "profile_updated"})
+		return app.Save(guilds)
+	}, func(app core.App) error {
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"name", "faction_type", "faction_name", "member_count", "achievement_points", "achievement_count",
+			"created_timestamp", "crest", "crest_emblem_url", "crest_border_url", "recent_achievements", "profile_updated"} {
+			guilds.Fields.RemoveByName(name)
+		}
+		return app.Save(guilds)
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+)
+
+// adds the avatar, inset and full render images of the characters as files,
+// together with the Blizzard asset urls they were downloaded from.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		mimeTypes := []string{"image/jpeg", "image/png", "image/webp"}
+		characters.Fields.Add(&core.FileField{Name: "avatar", MaxSelect: 1, MaxSize: 1 << 20, MimeTypes: mimeTypes, Thumbs: []string{"42x42", "84x84"}})
+		characters.Fields.Add(&core.FileField{Name: "inset", MaxSelect: 1, MaxSize: 2 << 20, MimeTypes: mimeTypes, Thumbs: []string{"230x116"}})
+		characters.Fields.Add(&core.FileField{Name: "main_raw", MaxSelect: 1, MaxSize: 10 << 20, MimeTypes: mimeTypes, Thumbs: []string{"0x400", "0x800"}})
+		characters.Fields.Add(&core.URLField{Name: "avatar_url"})
+		characters.Fields.Add(&core.URLField{Name: "inset_url"})
+		characters.Fields.Add(&core.URLField{Name: "main_raw_url"})
+		return app.Save(characters)
+	}, func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"avatar", "inset", "main_raw", "avatar_url", "inset_url", "main_raw_url"} {
+			characters.Fields.RemoveByName(name)
+		}
+		return app.Save(characters)
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the "character_talents" collection holding the active talent loadout of every specialization.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+
+		talents := core.NewBaseCollection("character_talents")
+		talents.ViewRule = types.Pointer("")
+		talents.ListRule = types.Pointer("")
+		talents.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		talents.Fields.Add(&core.NumberField{Name: "spec_id", OnlyInt: true, Required: true})
+		talents.Fields.Add(&core.TextField{Name: "spec_name"})
+		talents.Fields.Add(&core.BoolField{Name: "active"})
+		talents.Fields.Add(&core.TextField{Name: "loadout_code"})
+		talents.Fields.Add(&core.NumberField{Name: "hero_tree_id", OnlyInt: true})
+		talents.Fields.Add(&core.TextField{Name: "hero_tree_name"})
+		talents.Fields.Add(&core.JSONField{Name: "class_talents"})
+		talents.Fields.Add(&core.JSONField{Name: "spec_talents"})
+		talents.Fields.Add(&core.JSONField{Name: "hero_talents"})
+		talents.Fields.Add(&core.JSONField{Name: "pvp_talents"})
+		talents.AddIndex("idx_character_talents_character_spec_id", true, "character, spec_id", "")
+		return app.Save(talents)
+	}, func(app core.App) error {
+		talents, err := app.FindCollectionByNameOrId("character_talents")
+		if err != nil {
+			return nil // probably already deleted
+		}
+		return app.Delete(talents)
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the "character_pvp" collection holding the honor and the bracket ratings of the current pvp season.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+
+		pvp := core.NewBaseCollection("character_pvp")
+		pvp.ViewRule = types.Pointer("")
+		pvp.ListRule = types.Pointer("")
+		pvp.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		pvp.Fields.Add(&core.NumberField{Name: "season_id", OnlyInt: true})
+		pvp.Fields.Add(&core.NumberField{Name: "honor_level", OnlyInt: true})
+		pvp.Fields.Add(&core.NumberField{Name: "honorable_kills", OnlyInt: true})
+		pvp.Fields.Add(&core.NumberField{Name: "rating_2v2", OnlyInt: true})
+		pvp.Fields.Add(&core.NumberField{Name: "rating_3v3", OnlyInt: true})
+		pvp.Fields.Add(&core.NumberField{Name: "rating_rbg", OnlyInt: true})
+		pvp.Fields.Add(&core.NumberField{Name: "rating_shuffle", OnlyInt: true})
+		pvp.Fields.Add(&core.NumberField{Name: "rating_blitz", OnlyInt: true})
+		pvp.Fields.Add(&core.JSONField{Name: "brackets"})
+		pvp.AddIndex("idx_character_pvp_character_season_id", true, "character, season_id", "")
+		return app.Save(pvp)
+	}, func(app core.App) error {
+		pvp, err := app.FindCollectionByNameOrId("character_pvp")
+		if err != nil {
+			return nil // probably already deleted
+		}
+		return app.Delete(pvp)
+	})
+}
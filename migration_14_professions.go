@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the "character_professions" collection with the skill and known recipes per profession tier,
+// and the "recipes" collection mapping the known recipes to the items they craft.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+
+		professions := core.NewBaseCollection("character_professions")
+		professions.ViewRule = types.Pointer("")
+		professions.ListRule = types.Pointer("")
+		professions.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		professions.Fields.Add(&core.NumberField{Name: "tier_id", OnlyInt: true, Required: true})
+		professions.Fields.Add(&core.TextField{Name: "tier_name"})
+		professions.Fields.Add(&core.NumberField{Name: "profession_id", OnlyInt: true})
+		professions.Fields.Add(&core.TextField{Name: "profession_name"})
+		professions.Fields.Add(&core.BoolField{Name: "primary"})
+		professions.Fields.Add(&core.NumberField{Name: "skill_points", OnlyInt: true})
+		professions.Fields.Add(&core.NumberField{Name: "max_skill_points", OnlyInt: true})
+		professions.Fields.Add(&core.JSONField{Name: "known_recipes"})
+		professions.AddIndex("idx_character_professions_character_tier_id", true, "character, tier_id", "")
+		if err := app.Save(professions); err != nil {
+			return err
+		}
+
+		recipes := core.NewBaseCollection("recipes")
+		recipes.ViewRule = types.Pointer("")
+		recipes.ListRule = types.Pointer("")
+		recipes.Fields.Add(&core.NumberField{Name: "recipe_id", OnlyInt: true, Required: true})
+		recipes.Fields.Add(&core.TextField{Name: "name"})
+		recipes.Fields.Add(&core.NumberField{Name: "crafted_item_id", OnlyInt: true})
+		recipes.Fields.Add(&core.NumberField{Name: "alliance_crafted_item_id", OnlyInt: true})
+		recipes.Fields.Add(&core.NumberField{Name: "horde_crafted_item_id", OnlyInt: true})
+		recipes.Fields.Add(&core.TextField{Name: "crafted_item_name"})
+		recipes.AddIndex("idx_recipes_recipe_id", true, "recipe_id", "")
+		return app.Save(recipes)
+	}, func(app core.App) error {
+		for _, name := range []string{"recipes", "character_professions"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue // probably already deleted
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the per guild choice of collections to sync, the guild ranks of the alts they are skipped for
+// and the "character_collections" collection holding the count and ids of the collected mounts, pets,
+// toys, heirlooms and transmog appearances.
+func init() {
+	migrations.Register(func(app core.App) error {
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return err
+		}
+		guilds.Fields.Add(&core.SelectField{Name: "collections", Values: collectionTypeNames, MaxSelect: len(collectionTypeNames)})
+		guilds.Fields.Add(&core.JSONField{Name: "collection_alt_ranks"})
+		if err := app.Save(guilds); err != nil {
+			return err
+		}
+
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		collections := core.NewBaseCollection("character_collections")
+		collections.ViewRule = types.Pointer("")
+		collections.ListRule = types.Pointer("")
+		collections.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		collections.Fields.Add(&core.SelectField{Name: "type", Values: collectionTypeNames, MaxSelect: 1, Required: true})
+		collections.Fields.Add(&core.NumberField{Name: "count", OnlyInt: true})
+		collections.Fields.Add(&core.JSONField{Name: "ids", MaxSize: 1 << 20})
+		collections.AddIndex("idx_character_collections_character_type", true, "character, type", "")
+		return app.Save(collections)
+	}, func(app core.App) error {
+		if collections, err := app.FindCollectionByNameOrId("character_collections"); err == nil {
+			if err := app.Delete(collections); err != nil {
+				return err
+			}
+		}
+
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return err
+		}
+		guilds.Fields.RemoveByName("collections")
+		guilds.Fields.RemoveByName("collection_alt_ranks")
+		return app.Save(guilds)
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the "character_reputations" collection holding the standing and renown level per faction.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+
+		reputations := core.NewBaseCollection("character_reputations")
+		reputations.ViewRule = types.Pointer("")
+		reputations.ListRule = types.Pointer("")
+		reputations.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		reputations.Fields.Add(&core.NumberField{Name: "faction_id", OnlyInt: true, Required: true})
+		reputations.Fields.Add(&core.TextField{Name: "faction_name"})
+		reputations.Fields.Add(&core.TextField{Name: "standing_name"})
+		reputations.Fields.Add(&core.NumberField{Name: "tier", OnlyInt: true})
+		reputations.Fields.Add(&core.NumberField{Name: "raw", OnlyInt: true})
+		reputations.Fields.Add(&core.NumberField{Name: "value", OnlyInt: true})
+		reputations.Fields.Add(&core.NumberField{Name: "max", OnlyInt: true})
+		reputations.Fields.Add(&core.NumberField{Name: "renown_level", OnlyInt: true})
+		reputations.Fields.Add(&core.NumberField{Name: "paragon_value", OnlyInt: true})
+		reputations.Fields.Add(&core.NumberField{Name: "paragon_max", OnlyInt: true})
+		reputations.AddIndex("idx_character_reputations_character_faction_id", true, "character, faction_id", "")
+		return app.Save(reputations)
+	}, func(app core.App) error {
+		reputations, err := app.FindCollectionByNameOrId("character_reputations")
+		if err != nil {
+			return nil // probably already deleted
+		}
+		return app.Delete(reputations)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// adds the "character_achievements" collection with the achievement totals and statistics of every character,
+// the "character_achievement_progress" collection with one record per character and achievement
+// and the "guild_achievement_feed" collection listing the achievements members earned since the previous sync.
+func init() {
+	migrations.Register(func(app core.App) error {
+		characters, err := app.FindCollectionByNameOrId("characters")
+		if err != nil {
+			return err
+		}
+		guilds, err := app.FindCollectionByNameOrId("guilds")
+		if err != nil {
+			return err
+		}
+
+		achievements := core.NewBaseCollection("character_achievements")
+		achievements.ViewRule = types.Pointer("")
+		achievements.ListRule = types.Pointer("")
+		achievements.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		achievements.Fields.Add(&core.NumberField{Name: "total_quantity", OnlyInt: true})
+		achievements.Fields.Add(&core.NumberField{Name: "total_points", OnlyInt: true})
+		achievements.Fields.Add(&core.JSONField{Name: "statistics", MaxSize: 1 << 20})
+		achievements.AddIndex("idx_character_achievements_character", true, "character", "")
+		if err := app.Save(achievements); err != nil {
+			return err
+		}
+
+		progress := core.NewBaseCollection("character_achievement_progress")
+		progress.ViewRule = types.Pointer("")
+		progress.ListRule = types.Pointer("")
+		progress.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		progress.Fields.Add(&core.NumberField{Name: "achievement_id", OnlyInt: true, Required: true})
+		progress.Fields.Add(&core.NumberField{Name: "completed_timestamp", OnlyInt: true})
+		progress.Fields.Add(&core.NumberField{Name: "criteria_amount"})
+		progress.Fields.Add(&core.NumberField{Name: "child_completed", OnlyInt: true})
+		progress.Fields.Add(&core.NumberField{Name: "child_total", OnlyInt: true})
+		progress.AddIndex("idx_character_achievement_progress_character_achievement", true, "character, achievement_id", "")
+		if err := app.Save(progress); err != nil {
+			return err
+		}
+
+		feed := core.NewBaseCollection("guild_achievement_feed")
+		feed.ViewRule = types.Pointer("")
+		feed.ListRule = types.Pointer("")
+		feed.Fields.Add(&core.RelationField{Name: "guild", CollectionId: guilds.Id, MaxSelect: 1, CascadeDelete: true, Required: true})
+		feed.Fields.Add(&core.RelationField{Name: "character", CollectionId: characters.Id, MaxSelect: 1, CascadeDelete: true})
+		feed.Fields.Add(&core.TextField{Name: "character_name"})
+		feed.Fields.Add(&core.TextField{Name: "realm"})
+		feed.Fields.Add(&core.NumberField{Name: "achievement_id", OnlyInt: true, Required: true})
+		feed.Fields.Add(&core.TextField{Name: "achievement_name"})
+		feed.Fields.Add(&core.NumberField{Name: "completed_timestamp", OnlyInt: true})
+		feed.Fields.Add(&core.TextField{Name: "sync_run"})
+		feed.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		feed.AddIndex("idx_guild_achievement_feed_guild_created", false, "guild, created", "")
+		return app.Save(feed)
+	}, func(app core.App) error {
+		for _, name := range []string{"guild_achievement_feed", "character_achievement_progress", "character_achievements"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue // probably already deleted
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+)
+
+// adds the superuser only "selfupdate_events" collection recording every rollout of a new image and its outcome.
+func init() {
+	migrations.Register(func(app core.App) error {
+		events := core.NewBaseCollection("selfupdate_events")
+		events.Fields.Add(&core.TextField{Name: "image", Required: true})
+		events.Fields.Add(&core.TextField{Name: "reference"})
+		events.Fields.Add(&core.TextField{Name: "container"})
+		events.Fields.Add(&core.TextField{Name: "previous_digest"})
+		events.Fields.Add(&core.TextField{Name: "new_digest"})
+		events.Fields.Add(&core.TextField{Name: "previous_image_id"})
+		events.Fields.Add(&core.TextField{Name: "new_image_id"})
+		events.Fields.Add(&core.SelectField{Name: "status", Values: []string{rolloutPending, rolloutHealthy, rolloutRolledBack, rolloutFailed}, MaxSelect: 1, Required: true})
+		events.Fields.Add(&core.TextField{Name: "message"})
+		events.Fields.Add(&core.TextField{Name: "token", Hidden: true})
+		events.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		events.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		events.AddIndex("idx_selfupdate_events_created", false, "created", "")
+		return app.Save(events)
+	}, func(app core.App) error {
+		events, err := app.FindCollectionByNameOrId("selfupdate_events")
+		if err != nil {
+			return nil // probably already deleted
+		}
+		return app.Delete(events)
+	})
+}
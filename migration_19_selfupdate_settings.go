@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/migrations"
+)
+
+// adds the superuser only "selfupdate_settings" collection with the single record controlling the SelfUpdate cron
+// (schedule, pause and maintenance window) and holding the result of its last check.
+func init() {
+	migrations.Register(func(app core.App) error {
+		timePattern := `^([01][0-9]|2[0-3]):[0-5][0-9]$`
+		settings := core.NewBaseCollection("selfupdate_settings")
+		settings.Fields.Add(&core.TextField{Name: "schedule", Required: true})
+		settings.Fields.Add(&core.BoolField{Name: "paused"})
+		settings.Fields.Add(&core.TextField{Name: "maintenance_start", Pattern: timePattern})
+		settings.Fields.Add(&core.TextField{Name: "maintenance_end", Pattern: timePattern})
+		settings.Fields.Add(&core.DateField{Name: "last_check"})
+		settings.Fields.Add(&core.SelectField{Name: "last_result", Values: updateResults, MaxSelect: 1})
+		settings.Fields.Add(&core.TextField{Name: "last_error"})
+		settings.Fields.Add(&core.TextField{Name: "last_reference"})
+		settings.Fields.Add(&core.TextField{Name: "local_digest"})
+		settings.Fields.Add(&core.TextField{Name: "remote_digest"})
+		settings.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		if err := app.Save(settings); err != nil {
+			return err
+		}
+
+		record := core.NewRecord(settings)
+		record.Set("schedule", defaultUpdateSchedule)
+		return app.Save(record)
+	}, func(app core.App) error {
+		settings, err := app.FindCollectionByNameOrId("selfupdate_settings")
+		if err != nil {
+			return nil // probably already deleted
+		}
+		return app.Delete(settings)
+	})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// mythicRating is the rating object of the Mythic Keystone endpoints, the blizzard library doesn't decode it.
+type mythicRating struct {
+	Color struct {
+		R int     `json:"r"`
+		G int     `json:"g"`
+		B int     `json:"b"`
+		A float64 `json:"a"`
+	} `json:"color"`
+	Rating float64 `json:"rating"`
+}
+
+// hex returns the rating color as css hex color.
+func (r mythicRating) hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", r.Color.R, r.Color.G, r.Color.B)
+}
+
+type mythicKeystoneProfile struct {
+	CurrentMythicRating mythicRating `json:"current_mythic_rating"`
+	Seasons             []struct {
+		ID int `json:"id"`
+	} `json:"seasons"`
+}
+
+type mythicKeystoneSeason struct {
+	MythicRating mythicRating `json:"mythic_rating"`
+	BestRuns     []struct {
+		CompletedTimestamp int64 `json:"completed_timestamp"`
+		Duration           int64 `json:"duration"`
+		KeystoneLevel      int   `json:"keystone_level"`
+		KeystoneAffixes    []struct {
+			Name string `json:"name"`
+			ID   int    `json:"id"`
+		} `json:"keystone_affixes"`
+		Members []struct {
+			Character struct {
+				Name  string `json:"name"`
+				ID    int    `json:"id"`
+				Realm struct {
+					Slug string `json:"slug"`
+				} `json:"realm"`
+			} `json:"character"`
+			Specialization struct {
+				Name string `json:"name"`
+				ID   int    `json:"id"`
+			} `json:"specialization"`
+			EquippedItemLevel int `json:"equipped_item_level"`
+		} `json:"members"`
+		Dungeon struct {
+			Name string `json:"name"`
+			ID   int    `json:"id"`
+		} `json:"dungeon"`
+		IsCompletedWithinTime bool         `json:"is_completed_within_time"`
+		MythicRating          mythicRating `json:"mythic_rating"`
+	} `json:"best_runs"`
+}
+
+// mythicPlusData is the combined result of the profile and current season requests.
+type mythicPlusData struct {
+	seasonID int
+	profile  mythicKeystoneProfile
+	season   mythicKeystoneSeason
+}
+
+type mythicPlusAffix struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type mythicPlusPartyMember struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Realm     string `json:"realm"`
+	SpecID    int    `json:"spec_id"`
+	SpecName  string `json:"spec_name"`
+	ItemLevel int    `json:"item_level"`
+}
+
+func init() {
+	registerCharacterSync(characterSync{
+		name:  "mythic keystone profile",
+		fetch: fetchMythicPlus,
+		save:  saveMythicPlus,
+	})
+}
+
+func fetchMythicPlus(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+	path := fmt.Sprintf("/profile/wow/character/%s/%s/mythic-keystone-profile", realmSlug, url.PathEscape(strings.ToLower(characterName)))
+
+	data := &mythicPlusData{}
+	err := getProfileData(ctx, client, path, &data.profile)
+	if errors.Is(err, errNotFound) {
+		return data, nil // never ran a keystone
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, season := range data.profile.Seasons {
+		data.seasonID = max(data.seasonID, season.ID)
+	}
+	if data.seasonID == 0 {
+		return data, nil
+	}
+
+	// the profile changed, so the season is needed in full even if it didn't
+	err = getProfileData(withoutCache(ctx), client, fmt.Sprintf("%s/season/%d", path, data.seasonID), &data.season)
+	if err != nil && !errors.Is(err, errNotFound) {
+		return nil, err
+	}
+	return data, nil
+}
+
+// saveMythicPlus stores the current season rating in "mythic_plus_profiles"
+// and the best run per dungeon in "mythic_plus_runs".
+func saveMythicPlus(app core.App, character *core.Record, data any, runID string) error {
+	mythicPlus := data.(*mythicPlusData)
+
+	profiles := map[string]map[string]any{}
+	if mythicPlus.seasonID != 0 {
+		profiles[strconv.Itoa(mythicPlus.seasonID)] = map[string]any{
+			"rating":       mythicPlus.profile.CurrentMythicRating.Rating,
+			"rating_color": mythicPlus.profile.CurrentMythicRating.hex(),
+		}
+	}
+	if err := syncChildRecords(app, "mythic_plus_profiles", character, "season_id", profiles); err != nil {
+		return err
+	}
+
+	runs := map[string]map[string]any{}
+	for _, run := range mythicPlus.season.BestRuns {
+		key := strconv.Itoa(run.Dungeon.ID)
+		// older seasons list a fortified and a tyrannical run per dungeon, keep the better one
+		if existing, ok := runs[key]; ok && existing["rating"].(float64) >= run.MythicRating.Rating {
+			continue
+		}
+
+		affixes := make([]mythicPlusAffix, 0, len(run.KeystoneAffixes))
+		for _, affix := range run.KeystoneAffixes {
+			affixes = append(affixes, mythicPlusAffix{ID: affix.ID, Name: affix.Name})
+		}
+		members := make([]mythicPlusPartyMember, 0, len(run.Members))
+		for _, member := range run.Members {
+			members = append(members, mythicPlusPartyMember{
+				ID:        member.Character.ID,
+				Name:      member.Character.Name,
+				Realm:     member.Character.Realm.Slug,
+				SpecID:    member.Specialization.ID,
+				SpecName:  member.Specialization.Name,
+				ItemLevel: member.EquippedItemLevel,
+			})
+		}
+
+		runs[key] = map[string]any{
+			"season_id":           mythicPlus.seasonID,
+			"dungeon_name":        run.Dungeon.Name,
+			"keystone_level":      run.KeystoneLevel,
+			"duration":            run.Duration,
+			"timed":               run.IsCompletedWithinTime,
+			"completed_timestamp": run.CompletedTimestamp,
+			"rating":              run.MythicRating.Rating,
+			"rating_color":        run.MythicRating.hex(),
+			"affixes":             affixes,
+			"members":             members,
+		}
+	}
+	return syncChildRecords(app, "mythic_plus_runs", character, "dungeon_id", runs)
+}
+
+// mythicPlusLeaderboard lists the current season rating of all members (see memberFilter), best first.
+func mythicPlusLeaderboard(e *core.RequestEvent) error {
+	var records []*core.Record
+	err := e.App.RecordQuery("mythic_plus_profiles").
+		AndWhere(dbx.NewExp("[[rating]] > 0")).
+		AndWhere(memberFilter(e, "mythic_plus_profiles.character")).
+		OrderBy("[[rating]] DESC").
+		All(&records)
+	if err != nil {
+		return e.InternalServerError("Failed to load the leaderboard.", err)
+	}
+	if errs := e.App.ExpandRecords(records, []string{"character"}, nil); len(errs) > 0 {
+		return e.InternalServerError("Failed to load the leaderboard characters.", expandError(errs))
+	}
+
+	type entry struct {
+		Rank        int     `json:"rank"`
+		Character   string  `json:"character"`
+		Name        string  `json:"name"`
+		Realm       string  `json:"realm"`
+		ClassID     int     `json:"character_class_id"`
+		SpecName    string  `json:"active_spec_name"`
+		SeasonID    int     `json:"season_id"`
+		Rating      float64 `json:"rating"`
+		RatingColor string  `json:"rating_color"`
+	}
+	leaderboard := make([]entry, 0, len(records))
+	for _, record := range records {
+		character := record.ExpandedOne("character")
+		if character == nil {
+			continue
+		}
+		leaderboard = append(leaderboard, entry{
+			Rank:        len(leaderboard) + 1,
+			Character:   character.Id,
+			Name:        character.GetString("name"),
+			Realm:       character.GetString("realm"),
+			ClassID:     character.GetInt("character_class_id"),
+			SpecName:    character.GetString("active_spec_name"),
+			SeasonID:    record.GetInt("season_id"),
+			Rating:      record.GetFloat("rating"),
+			RatingColor: record.GetString("rating_color"),
+		})
+	}
+	return e.JSON(http.StatusOK, leaderboard)
+}
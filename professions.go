@@ -0,0 +1,199 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/FuzzyStatic/blizzard/v3/wowp"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type recipeItem struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+}
+
+// recipeData is the recipe of the game data API, the blizzard library lacks the faction specific crafted items.
+type recipeData struct {
+	ID                  int        `json:"id"`
+	Name                string     `json:"name"`
+	CraftedItem         recipeItem `json:"crafted_item"`
+	AllianceCraftedItem recipeItem `json:"alliance_crafted_item"`
+	HordeCraftedItem    recipeItem `json:"horde_crafted_item"`
+}
+
+func init() {
+	registerCharacterSync(characterSync{
+		name: "professions",
+		fetch: func(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+			professions, _, err := client.WoWCharacterProfessionsSummary(ctx, realmSlug, characterName)
+			return professions, err
+		},
+		save: saveProfessions,
+	})
+}
+
+// saveProfessions stores one "character_professions" record per profession tier (e.g. "Khaz Algar Tailoring").
+func saveProfessions(app core.App, character *core.Record, data any, runID string) error {
+	professions := data.(*wowp.CharacterProfessionsSummary)
+
+	// both lists share the same structure, the primaries come first
+	primaries := len(professions.Primaries)
+	rows := map[string]map[string]any{}
+	for i, profession := range append(slices.Clip(professions.Primaries), professions.Secondaries...) {
+		for _, tier := range profession.Tiers {
+			recipes := make([]int, 0, len(tier.KnownRecipes))
+			for _, recipe := range tier.KnownRecipes {
+				recipes = append(recipes, recipe.ID)
+			}
+			slices.Sort(recipes)
+			rows[strconv.Itoa(tier.Tier.ID)] = map[string]any{
+				"tier_name":        tier.Tier.Name,
+				"profession_id":    profession.Profession.ID,
+				"profession_name":  profession.Profession.Name,
+				"primary":          i < primaries,
+				"skill_points":     tier.SkillPoints,
+				"max_skill_points": tier.MaxSkillPoints,
+				"known_recipes":    recipes,
+			}
+		}
+	}
+	return syncChildRecords(app, "character_professions", character, "tier_id", rows)
+}
+
+// resolveRecipes looks up the crafted items of known recipes missing in the "recipes" collection.
+// At most RECIPE_LOOKUPS_PER_RUN (defaults to 200) recipes are requested per sync, so the first
+// sync of a guild doesn't use up the hourly quota.
+func resolveRecipes(ctx context.Context, app core.App, client *blizzard.Client) {
+	var recipeIDs []int
+	err := app.DB().NewQuery(
+		"SELECT DISTINCT [[j.value]] FROM {{character_professions}} p, json_each(p.known_recipes) j" +
+			" WHERE [[j.value]] NOT IN (SELECT [[recipe_id]] FROM {{recipes}}) LIMIT {:limit}",
+	).Bind(dbx.Params{"limit": envInt("RECIPE_LOOKUPS_PER_RUN", 200)}).Column(&recipeIDs)
+	if err != nil {
+		log.Printf("Error finding unknown recipes: %v", err)
+		return
+	}
+	if len(recipeIDs) == 0 {
+		return
+	}
+	collection, err := app.FindCollectionByNameOrId("recipes")
+	if err != nil {
+		log.Printf("Error finding collection: %v", err)
+		return
+	}
+
+	resolved := 0
+	for _, recipeID := range recipeIDs {
+		var recipe recipeData
+		err := getStaticData(withoutCache(ctx), client, fmt.Sprintf("/data/wow/recipe/%d", recipeID), &recipe)
+		if err != nil && !errors.Is(err, errNotFound) {
+			// retried with the next sync
+			log.Printf("Error fetching recipe %d: %v", recipeID, err)
+			break
+		}
+		// recipes Blizzard doesn't know are stored without an item, so they aren't requested again
+		record := core.NewRecord(collection)
+		record.Set("recipe_id", recipeID)
+		record.Set("name", recipe.Name)
+		record.Set("crafted_item_id", recipe.CraftedItem.ID)
+		record.Set("alliance_crafted_item_id", recipe.AllianceCraftedItem.ID)
+		record.Set("horde_crafted_item_id", recipe.HordeCraftedItem.ID)
+		record.Set("crafted_item_name", cmp.Or(recipe.CraftedItem.Name, recipe.AllianceCraftedItem.Name, recipe.HordeCraftedItem.Name))
+		if err := app.Save(record); err != nil {
+			log.Printf("Error saving recipe %d: %v", recipeID, err)
+			continue
+		}
+		resolved++
+	}
+	log.Printf("Resolved %d of %d unknown recipes.", resolved, len(recipeIDs))
+}
+
+// professionCrafters answers "who can craft X": it lists the members (see memberFilter) knowing the recipe
+// given by the "recipe" query parameter, or any recipe crafting the item given by "item", highest skill first.
+func professionCrafters(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+	recipeIDs := []int{}
+	switch {
+	case query.Get("recipe") != "":
+		recipeID, err := strconv.Atoi(query.Get("recipe"))
+		if err != nil {
+			return e.BadRequestError("Invalid recipe value.", err)
+		}
+		recipeIDs = append(recipeIDs, recipeID)
+	case query.Get("item") != "":
+		itemID, err := strconv.Atoi(query.Get("item"))
+		if err != nil {
+			return e.BadRequestError("Invalid item value.", err)
+		}
+		recipes, err := e.App.FindRecordsByFilter("recipes", "crafted_item_id = {:item} || alliance_crafted_item_id = {:item} || horde_crafted_item_id = {:item}", "", 0, 0, dbx.Params{"item": itemID})
+		if err != nil {
+			return e.InternalServerError("Failed to load the recipes.", err)
+		}
+		for _, recipe := range recipes {
+			recipeIDs = append(recipeIDs, recipe.GetInt("recipe_id"))
+		}
+	default:
+		return e.BadRequestError("Missing recipe or item value.", nil)
+	}
+
+	type crafter struct {
+		Character      string `json:"character"`
+		Name           string `json:"name"`
+		Realm          string `json:"realm"`
+		ProfessionName string `json:"profession_name"`
+		TierName       string `json:"tier_name"`
+		SkillPoints    int    `json:"skill_points"`
+		MaxSkillPoints int    `json:"max_skill_points"`
+	}
+	crafters := []crafter{}
+	if len(recipeIDs) == 0 {
+		return e.JSON(http.StatusOK, map[string]any{"recipes": recipeIDs, "crafters": crafters})
+	}
+
+	params := dbx.Params{}
+	placeholders := make([]string, 0, len(recipeIDs))
+	for i, recipeID := range recipeIDs {
+		name := "recipe" + strconv.Itoa(i)
+		params[name] = recipeID
+		placeholders = append(placeholders, "{:"+name+"}")
+	}
+	var records []*core.Record
+	err := e.App.RecordQuery("character_professions").
+		AndWhere(dbx.NewExp("EXISTS (SELECT 1 FROM json_each([[character_professions.known_recipes]]) WHERE [[value]] IN ("+strings.Join(placeholders, ", ")+"))", params)).
+		AndWhere(memberFilter(e, "character_professions.character")).
+		OrderBy("skill_points DESC").
+		All(&records)
+	if err != nil {
+		return e.InternalServerError("Failed to load the crafters.", err)
+	}
+	if errs := e.App.ExpandRecords(records, []string{"character"}, nil); len(errs) > 0 {
+		return e.InternalServerError("Failed to load the crafter characters.", expandError(errs))
+	}
+
+	for _, record := range records {
+		character := record.ExpandedOne("character")
+		if character == nil {
+			continue
+		}
+		crafters = append(crafters, crafter{
+			Character:      character.Id,
+			Name:           character.GetString("name"),
+			Realm:          character.GetString("realm"),
+			ProfessionName: record.GetString("profession_name"),
+			TierName:       record.GetString("tier_name"),
+			SkillPoints:    record.GetInt("skill_points"),
+			MaxSkillPoints: record.GetInt("max_skill_points"),
+		})
+	}
+	return e.JSON(http.StatusOK, map[string]any{"recipes": recipeIDs, "crafters": crafters})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type pvpSummary struct {
+	HonorLevel     int `json:"honor_level"`
+	HonorableKills int `json:"honorable_kills"`
+	Brackets       []struct {
+		Href string `json:"href"`
+	} `json:"brackets"`
+}
+
+type pvpMatchStatistics struct {
+	Played int `json:"played"`
+	Won    int `json:"won"`
+	Lost   int `json:"lost"`
+}
+
+type pvpBracketStatistics struct {
+	Bracket struct {
+		ID   int    `json:"id"`
+		Type string `json:"type"`
+	} `json:"bracket"`
+	Rating int `json:"rating"`
+	Season struct {
+		ID int `json:"id"`
+	} `json:"season"`
+	Specialization struct {
+		Name string `json:"name"`
+		ID   int    `json:"id"`
+	} `json:"specialization"`
+	SeasonMatchStatistics pvpMatchStatistics `json:"season_match_statistics"`
+	WeeklyMatchStatistics pvpMatchStatistics `json:"weekly_match_statistics"`
+}
+
+// pvpData is the combined result of the pvp summary and bracket requests, keyed by the bracket of the url.
+type pvpData struct {
+	summary  pvpSummary
+	brackets map[string]pvpBracketStatistics
+}
+
+// pvpBracket is a bracket as stored in the "brackets" field of "character_pvp".
+type pvpBracket struct {
+	Bracket  string             `json:"bracket"`
+	Type     string             `json:"type"`
+	SpecID   int                `json:"spec_id,omitempty"`
+	SpecName string             `json:"spec_name,omitempty"`
+	Rating   int                `json:"rating"`
+	Season   pvpMatchStatistics `json:"season"`
+	Weekly   pvpMatchStatistics `json:"weekly"`
+}
+
+// pvpRatingFields maps the bracket types to the rating fields of "character_pvp", solo shuffle
+// and blitz are rated per specialization and keep the best one.
+var pvpRatingFields = map[string]string{
+	"ARENA_2v2":     "rating_2v2",
+	"ARENA_3v3":     "rating_3v3",
+	"BATTLEGROUNDS": "rating_rbg",
+	"SHUFFLE":       "rating_shuffle",
+	"BLITZ":         "rating_blitz",
+}
+
+func init() {
+	registerCharacterSync(characterSync{
+		name:  "pvp",
+		fetch: fetchPvP,
+		save:  savePvP,
+	})
+}
+
+func fetchPvP(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+	characterPath := fmt.Sprintf("/profile/wow/character/%s/%s", realmSlug, url.PathEscape(strings.ToLower(characterName)))
+
+	data := &pvpData{brackets: map[string]pvpBracketStatistics{}}
+	err := getProfileData(ctx, client, characterPath+"/pvp-summary", &data.summary)
+	if errors.Is(err, errNotFound) {
+		return data, nil // never played rated pvp
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the summary changed, so all brackets are needed in full even if some didn't
+	for _, link := range data.summary.Brackets {
+		href, err := url.Parse(link.Href)
+		if err != nil {
+			continue
+		}
+		bracket := path.Base(href.Path)
+		var statistics pvpBracketStatistics
+		err = getProfileData(withoutCache(ctx), client, characterPath+"/pvp-bracket/"+bracket, &statistics)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data.brackets[bracket] = statistics
+	}
+	return data, nil
+}
+
+// savePvP stores the honor and the bracket ratings of the current season in "character_pvp".
+func savePvP(app core.App, character *core.Record, data any, runID string) error {
+	pvp := data.(*pvpData)
+
+	row := map[string]any{
+		"honor_level":     pvp.summary.HonorLevel,
+		"honorable_kills": pvp.summary.HonorableKills,
+	}
+	for _, field := range pvpRatingFields {
+		row[field] = 0
+	}
+	seasonID := 0
+	brackets := make([]pvpBracket, 0, len(pvp.brackets))
+	for bracket, statistics := range pvp.brackets {
+		seasonID = max(seasonID, statistics.Season.ID)
+		brackets = append(brackets, pvpBracket{
+			Bracket:  bracket,
+			Type:     statistics.Bracket.Type,
+			SpecID:   statistics.Specialization.ID,
+			SpecName: statistics.Specialization.Name,
+			Rating:   statistics.Rating,
+			Season:   statistics.SeasonMatchStatistics,
+			Weekly:   statistics.WeeklyMatchStatistics,
+		})
+		if field, ok := pvpRatingFields[statistics.Bracket.Type]; ok {
+			row[field] = max(row[field].(int), statistics.Rating)
+		}
+	}
+	// sorted for a stable diff, the brackets come from a map
+	slices.SortFunc(brackets, func(a, b pvpBracket) int { return strings.Compare(a.Bracket, b.Bracket) })
+	row["brackets"] = brackets
+
+	rows := map[string]map[string]any{}
+	if pvp.summary.HonorLevel > 0 || len(brackets) > 0 {
+		rows[strconv.Itoa(seasonID)] = row
+	}
+	return syncChildRecords(app, "character_pvp", character, "season_id", rows)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/FuzzyStatic/blizzard/v3/wowp"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// difficultyOrder sorts raid difficulties from lowest to highest.
+var difficultyOrder = map[string]int{
+	"LFR":    0,
+	"NORMAL": 1,
+	"HEROIC": 2,
+	"MYTHIC": 3,
+}
+
+func init() {
+	registerCharacterSync(characterSync{
+		name: "raids",
+		fetch: func(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+			raids, _, err := client.WoWCharacterRaids(ctx, realmSlug, characterName)
+			return raids, err
+		},
+		save: saveRaidKills,
+	})
+}
+
+// saveRaidKills stores the boss kills of the current expansion in "raid_kills", one record per
+// raid, difficulty and boss. Blizzard only reports the last kill of a boss, so the first seen kill is
+// the last kill seen when the record is created and kept from then on. For bosses killed before the
+// first sync it is the most recent of those kills, not the first one.
+func saveRaidKills(app core.App, character *core.Record, data any, runID string) error {
+	raids := data.(*wowp.CharacterRaids)
+	if len(raids.Expansions) == 0 {
+		return syncChildRecords(app, "raid_kills", character, "encounter_key", nil)
+	}
+	current := raids.Expansions[0]
+	for _, expansion := range raids.Expansions {
+		if expansion.Expansion.ID > current.Expansion.ID {
+			current = expansion
+		}
+	}
+
+	records, err := app.FindAllRecords("raid_kills", dbx.HashExp{"character": character.Id})
+	if err != nil {
+		return err
+	}
+	firstSeenKills := make(map[string]int64, len(records))
+	for _, record := range records {
+		firstSeenKills[record.GetString("encounter_key")] = int64(record.GetInt("first_seen_kill_timestamp"))
+	}
+
+	rows := map[string]map[string]any{}
+	for _, instance := range current.Instances {
+		for _, mode := range instance.Modes {
+			for _, encounter := range mode.Progress.Encounters {
+				if encounter.CompletedCount == 0 {
+					continue
+				}
+				key := fmt.Sprintf("%d-%s-%d", instance.Instance.ID, mode.Difficulty.Type, encounter.Encounter.ID)
+				firstSeenKill, ok := firstSeenKills[key]
+				if !ok || firstSeenKill == 0 {
+					firstSeenKill = encounter.LastKillTimestamp
+				}
+				rows[key] = map[string]any{
+					"expansion_id":              current.Expansion.ID,
+					"expansion_name":            current.Expansion.Name,
+					"instance_id":               instance.Instance.ID,
+					"instance_name":             instance.Instance.Name,
+					"difficulty":                mode.Difficulty.Type,
+					"difficulty_name":           mode.Difficulty.Name,
+					"encounter_id":              encounter.Encounter.ID,
+					"encounter_name":            encounter.Encounter.Name,
+					"total_count":               mode.Progress.TotalCount,
+					"completed_count":           encounter.CompletedCount,
+					"last_kill_timestamp":       encounter.LastKillTimestamp,
+					"first_seen_kill_timestamp": firstSeenKill,
+				}
+			}
+		}
+	}
+	return syncChildRecords(app, "raid_kills", character, "encounter_key", rows)
+}
+
+// guildProgression aggregates the raid kills of the members of a guild into the progression per raid
+// and difficulty, e.g. "7/8 Heroic". A boss counts as killed once at least "min_members" members
+// (defaults to 5) have killed it, so a single member's pug kill doesn't count as guild progress.
+func guildProgression(e *core.RequestEvent) error {
+	guild, err := e.App.FindRecordById("guilds", e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Guild not found.", err)
+	}
+	minMembers := 5
+	if value := e.Request.URL.Query().Get("min_members"); value != "" {
+		minMembers, err = strconv.Atoi(value)
+		if err != nil || minMembers < 1 {
+			return e.BadRequestError("Invalid min_members value.", err)
+		}
+	}
+
+	records, err := e.App.FindRecordsByFilter("raid_kills", "character.guild = {:guild} && character.status != 'left'", "", 0, 0, dbx.Params{"guild": guild.Id})
+	if err != nil {
+		return e.InternalServerError("Failed to load the raid kills.", err)
+	}
+
+	type progression struct {
+		InstanceID     int    `json:"instance_id"`
+		InstanceName   string `json:"instance_name"`
+		Difficulty     string `json:"difficulty"`
+		DifficultyName string `json:"difficulty_name"`
+		Killed         int    `json:"killed"`
+		Total          int    `json:"total"`
+		Summary        string `json:"summary"`
+		killers        map[int]int
+	}
+	modes := map[string]*progression{}
+	for _, record := range records {
+		key := record.GetString("instance_id") + "-" + record.GetString("difficulty")
+		mode, ok := modes[key]
+		if !ok {
+			mode = &progression{
+				InstanceID:     record.GetInt("instance_id"),
+				InstanceName:   record.GetString("instance_name"),
+				Difficulty:     record.GetString("difficulty"),
+				DifficultyName: record.GetString("difficulty_name"),
+				killers:        map[int]int{},
+			}
+			modes[key] = mode
+		}
+		mode.Total = max(mode.Total, record.GetInt("total_count"))
+		mode.killers[record.GetInt("encounter_id")]++
+	}
+
+	result := make([]*progression, 0, len(modes))
+	for _, mode := range modes {
+		for _, killers := range mode.killers {
+			if killers >= minMembers {
+				mode.Killed++
+			}
+		}
+		if mode.Killed == 0 {
+			continue
+		}
+		mode.Summary = fmt.Sprintf("%d/%d %s", mode.Killed, mode.Total, mode.DifficultyName)
+		result = append(result, mode)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].InstanceID != result[j].InstanceID {
+			return result[i].InstanceID > result[j].InstanceID
+		}
+		return difficultyOrder[result[i].Difficulty] < difficultyOrder[result[j].Difficulty]
+	})
+
+	return e.JSON(http.StatusOK, result)
+}
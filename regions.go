@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+)
+
+// regions maps the region values of the "guilds" collection to the Blizzard API regions.
+var regions = map[string]blizzard.Region{
+	"us": blizzard.US,
+	"eu": blizzard.EU,
+	"kr": blizzard.KR,
+	"tw": blizzard.TW,
+	"cn": blizzard.CN,
+}
+
+// defaultLocales is used for guilds that don't specify a locale.
+var defaultLocales = map[blizzard.Region]blizzard.Locale{
+	blizzard.US: blizzard.EnUS,
+	blizzard.EU: blizzard.EnGB,
+	blizzard.KR: blizzard.KoKR,
+	blizzard.TW: blizzard.ZhTW,
+	blizzard.CN: blizzard.ZhCN,
+}
+
+// allLocales lists every locale known to the Blizzard API.
+var allLocales = []string{
+	blizzard.EnUS.String(), blizzard.EsMX.String(), blizzard.PtBR.String(),
+	blizzard.EnGB.String(), blizzard.EsES.String(), blizzard.FrFR.String(), blizzard.RuRU.String(),
+	blizzard.PtPT.String(), blizzard.DeDE.String(), blizzard.ItIT.String(),
+	blizzard.KoKR.String(), blizzard.ZhTW.String(), blizzard.ZhCN.String(),
+}
+
+// blizzTransport, blizzCache and throttledClient are shared by all Blizzard clients, the API quota applies per client id and not per region.
+var (
+	blizzTransport  = NewThrottledTransport(time.Second/10, 100, http.DefaultTransport) // allows 10 requests every second //36000 per Hour
+	blizzCache      = NewCachingTransport(blizzTransport)
+	throttledClient = &http.Client{Transport: blizzCache}
+)
+
+type clientKey struct {
+	region blizzard.Region
+	locale blizzard.Locale
+}
+
+var (
+	blizzClientsMu sync.Mutex
+	blizzClients   = map[clientKey]*blizzard.Client{}
+)
+
+// parseRegion resolves a region and locale pair as stored on a guild record,
+// an empty locale falls back to the default locale of the region.
+func parseRegion(region, locale string) (blizzard.Region, blizzard.Locale, error) {
+	r, ok := regions[region]
+	if !ok {
+		return 0, "", fmt.Errorf("unknown region '%s'", region)
+	}
+	if locale == "" {
+		return r, defaultLocales[r], nil
+	}
+	return r, blizzard.Locale(locale), nil
+}
+
+// getBlizzClient returns the cached Blizzard client for the given region and locale,
+// creating and authorizing it on first use.
+func getBlizzClient(ctx context.Context, region blizzard.Region, locale blizzard.Locale) (*blizzard.Client, error) {
+	blizzClientsMu.Lock()
+	defer blizzClientsMu.Unlock()
+
+	key := clientKey{region: region, locale: locale}
+	if client, ok := blizzClients[key]; ok {
+		return client, nil
+	}
+
+	client, err := blizzard.NewClient(blizzard.Config{
+		ClientID:     goDotEnvVariable("CLIENT_ID"),
+		ClientSecret: goDotEnvVariable("CLIENT_SECRET"),
+		HTTPClient:   throttledClient,
+		Region:       region,
+		Locale:       locale,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s/%s client: %w", region, locale, err)
+	}
+	if err := client.AccessTokenRequest(ctx); err != nil {
+		return nil, fmt.Errorf("failed to request %s access token: %w", region, err)
+	}
+
+	blizzClients[key] = client
+	return client, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// registryCredentials are the credentials of the image registry, read from SELFUPDATE_REGISTRY_USERNAME and
+// SELFUPDATE_REGISTRY_PASSWORD or from the docker config.json in DOCKER_CONFIG (defaults to ~/.docker).
+// Without credentials the registry is accessed anonymously.
+type registryCredentials struct {
+	username string
+	password string
+}
+
+func loadRegistryCredentials(cfg updateConfig) registryCredentials {
+	if username := goDotEnvVariable("SELFUPDATE_REGISTRY_USERNAME"); username != "" {
+		return registryCredentials{username: username, password: goDotEnvVariable("SELFUPDATE_REGISTRY_PASSWORD")}
+	}
+
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return registryCredentials{}
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return registryCredentials{}
+	}
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(raw, &dockerConfig); err != nil {
+		return registryCredentials{}
+	}
+
+	// docker login stores Docker Hub under its legacy index url, other registries by host with or without scheme
+	keys := []string{cfg.host, "https://" + cfg.host, "http://" + cfg.host}
+	if cfg.host == "docker.io" {
+		keys = append(keys, "https://index.docker.io/v1/", "index.docker.io")
+	}
+	for _, key := range keys {
+		auth, ok := dockerConfig.Auths[key]
+		if !ok {
+			continue
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				continue
+			}
+			username, password, _ := strings.Cut(string(decoded), ":")
+			return registryCredentials{username: username, password: password}
+		}
+		if auth.Username != "" {
+			return registryCredentials{username: auth.Username, password: auth.Password}
+		}
+	}
+	return registryCredentials{}
+}
+
+// dockerAuthHeader returns the X-Registry-Auth header value the Docker Engine API expects for pulls,
+// empty for anonymous access.
+func (c registryCredentials) dockerAuthHeader(cfg updateConfig) string {
+	if c.username == "" {
+		return ""
+	}
+	raw, _ := json.Marshal(map[string]string{
+		"username":      c.username,
+		"password":      c.password,
+		"serveraddress": cfg.host,
+	})
+	return base64.URLEncoding.EncodeToString(raw)
+}
+
+// registryClient sends requests to the registry v2 API and answers its authentication challenges.
+type registryClient struct {
+	cfg           updateConfig
+	credentials   registryCredentials
+	authorization string
+}
+
+func newRegistryClient(cfg updateConfig) *registryClient {
+	return &registryClient{cfg: cfg, credentials: loadRegistryCredentials(cfg)}
+}
+
+// do sends the request, a 401 response is answered once with the auth flow of its WWW-Authenticate header
+// (basic auth, or a bearer token of the announced realm) and the request is repeated.
+// The authorization is kept for the following requests of the client.
+func (c *registryClient) do(req *http.Request) (*http.Response, error) {
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	authorization, err := c.authenticate(req.Context(), challenge)
+	if err != nil {
+		return nil, err
+	}
+	c.authorization = authorization
+	retry := req.Clone(req.Context())
+	retry.Header.Set("Authorization", authorization)
+	return http.DefaultClient.Do(retry)
+}
+
+// authenticate returns the Authorization header value answering a WWW-Authenticate challenge.
+func (c *registryClient) authenticate(ctx context.Context, challenge string) (string, error) {
+	scheme, params := parseAuthChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.credentials.username == "" {
+			return "", fmt.Errorf("registry %s requires credentials", c.cfg.host)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.credentials.username+":"+c.credentials.password)), nil
+	case "bearer":
+		token, err := c.requestToken(ctx, params)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "", fmt.Errorf("unsupported registry authentication %q", challenge)
+}
+
+// requestToken fetches a bearer token from the realm of a challenge, with the credentials if there are any.
+func (c *registryClient) requestToken(ctx context.Context, params map[string]string) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("no realm in registry authentication challenge")
+	}
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid registry token realm: %w", err)
+	}
+	query := tokenURL.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", "repository:"+c.cfg.repo+":pull")
+	if scope := params["scope"]; scope != "" {
+		query.Set("scope", scope)
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.credentials.username != "" {
+		req.SetBasicAuth(c.credentials.username, c.credentials.password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request registry token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("registry token request failed (%d): %s", resp.StatusCode, body)
+	}
+
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokenResp.Token != "" {
+		return tokenResp.Token, nil
+	}
+	if tokenResp.AccessToken != "" {
+		return tokenResp.AccessToken, nil
+	}
+	return "", fmt.Errorf("no token in registry token response")
+}
+
+// parseAuthChallenge splits a WWW-Authenticate header like
+// Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:jrsmile/blizbase:pull"
+// into its scheme and parameters.
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(value, `"`) {
+			// quoted values may contain commas, e.g. a scope with several actions
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[key] = value[1:]
+				break
+			}
+			params[key] = value[1 : end+1]
+			rest = strings.TrimPrefix(strings.TrimSpace(value[end+2:]), ",")
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			params[key] = strings.TrimSpace(value)
+		}
+	}
+	return scheme, params
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseAuthChallenge(t *testing.T) {
+	tests := []struct {
+		challenge string
+		scheme    string
+		params    map[string]string
+	}{
+		{
+			challenge: `Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:jrsmile/blizbase:pull"`,
+			scheme:    "Bearer",
+			params:    map[string]string{"realm": "https://ghcr.io/token", "service": "ghcr.io", "scope": "repository:jrsmile/blizbase:pull"},
+		},
+		{
+			challenge: `Bearer realm="https://auth.docker.io/token", service="registry.docker.io", scope="repository:library/alpine:pull,push"`,
+			scheme:    "Bearer",
+			params:    map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io", "scope": "repository:library/alpine:pull,push"},
+		},
+		{
+			challenge: `Basic realm="Registry Realm"`,
+			scheme:    "Basic",
+			params:    map[string]string{"realm": "Registry Realm"},
+		},
+		{
+			challenge: `Bearer Realm=https://example.com/token,service=example.com`,
+			scheme:    "Bearer",
+			params:    map[string]string{"realm": "https://example.com/token", "service": "example.com"},
+		},
+		{
+			challenge: `Bearer realm="https://example.com/token`,
+			scheme:    "Bearer",
+			params:    map[string]string{"realm": "https://example.com/token"},
+		},
+		{
+			challenge: `Basic`,
+			scheme:    "Basic",
+			params:    map[string]string{},
+		},
+		{
+			challenge: ``,
+			scheme:    "",
+			params:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		scheme, params := parseAuthChallenge(tt.challenge)
+		if scheme != tt.scheme || !maps.Equal(params, tt.params) {
+			t.Errorf("parseAuthChallenge(%q) = %q, %v, want %q, %v", tt.challenge, scheme, params, tt.scheme, tt.params)
+		}
+	}
+}
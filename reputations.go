@@ -0,0 +1,136 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/FuzzyStatic/blizzard/v3/wowp"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	registerCharacterSync(characterSync{
+		name: "reputations",
+		fetch: func(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+			reputations, _, err := client.WoWCharacterReputationsSummary(ctx, realmSlug, characterName)
+			return reputations, err
+		},
+		save: saveReputations,
+	})
+}
+
+// saveReputations stores the standing of every faction in "character_reputations", renown level and standing
+// changes are recorded in the character history, e.g. as "character_reputations.2590.renown_level".
+func saveReputations(app core.App, character *core.Record, data any, runID string) error {
+	reputations := data.(*wowp.CharacterReputationsSummary)
+
+	rows := make(map[string]map[string]any, len(reputations.Reputations))
+	for _, reputation := range reputations.Reputations {
+		rows[strconv.Itoa(reputation.Faction.ID)] = map[string]any{
+			"faction_name":  reputation.Faction.Name,
+			"standing_name": reputation.Standing.Name,
+			"tier":          reputation.Standing.Tier,
+			"raw":           reputation.Standing.Raw,
+			"value":         reputation.Standing.Value,
+			"max":           reputation.Standing.Max,
+			"renown_level":  reputation.Standing.RenownLevel,
+			"paragon_value": reputation.Paragon.Value,
+			"paragon_max":   reputation.Paragon.Max,
+		}
+	}
+	return syncChildRecordsWithHistory(app, "character_reputations", character, "faction_id", rows, runID, "renown_level", "standing_name")
+}
+
+// guildRenown returns the renown levels the members of a guild gained per major faction within the last
+// "days" query parameter days (defaults to 7), computed from the character history, biggest gain first.
+func guildRenown(e *core.RequestEvent) error {
+	guild, err := e.App.FindRecordById("guilds", e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Guild not found.", err)
+	}
+	days, err := queryDays(e, 7)
+	if err != nil {
+		return err
+	}
+	since := types.NowDateTime().AddDate(0, 0, -days)
+
+	records, err := e.App.FindRecordsByFilter(
+		"character_history",
+		"field ~ {:field} && created >= {:since} && character.guild = {:guild} && character.status != 'left'",
+		"created", 0, 0,
+		dbx.Params{"field": "character_reputations.%.renown_level", "since": since.String(), "guild": guild.Id},
+	)
+	if err != nil {
+		return e.InternalServerError("Failed to load the renown history.", err)
+	}
+	if errs := e.App.ExpandRecords(records, []string{"character"}, nil); len(errs) > 0 {
+		return e.InternalServerError("Failed to load the renown characters.", expandError(errs))
+	}
+
+	type entry struct {
+		Character   string `json:"character"`
+		Name        string `json:"name"`
+		Realm       string `json:"realm"`
+		FactionID   int    `json:"faction_id"`
+		FactionName string `json:"faction_name"`
+		From        int    `json:"from"`
+		To          int    `json:"to"`
+		Gain        int    `json:"gain"`
+	}
+	// the history is oldest first, so the first change of a faction holds the starting level
+	entries := map[string]*entry{}
+	for _, record := range records {
+		character := record.ExpandedOne("character")
+		factionID, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(record.GetString("field"), "character_reputations."), ".renown_level"))
+		if character == nil || err != nil {
+			continue
+		}
+		oldLevel, _ := strconv.Atoi(record.GetString("old_value"))
+		newLevel, _ := strconv.Atoi(record.GetString("new_value"))
+		key := character.Id + "." + strconv.Itoa(factionID)
+		if _, ok := entries[key]; !ok {
+			entries[key] = &entry{
+				Character: character.Id,
+				Name:      character.GetString("name"),
+				Realm:     character.GetString("realm"),
+				FactionID: factionID,
+				From:      oldLevel,
+			}
+		}
+		entries[key].To = newLevel
+	}
+
+	factionNames := map[int]string{}
+	gains := make([]entry, 0, len(entries))
+	for _, gain := range entries {
+		gain.Gain = gain.To - gain.From
+		if gain.Gain <= 0 {
+			continue
+		}
+		name, ok := factionNames[gain.FactionID]
+		if !ok {
+			if reputation, err := e.App.FindFirstRecordByData("character_reputations", "faction_id", gain.FactionID); err == nil {
+				name = reputation.GetString("faction_name")
+			}
+			factionNames[gain.FactionID] = name
+		}
+		gain.FactionName = name
+		gains = append(gains, *gain)
+	}
+	slices.SortFunc(gains, func(a, b entry) int {
+		return cmp.Or(b.Gain-a.Gain, strings.Compare(a.Name, b.Name), a.FactionID-b.FactionID)
+	})
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"guild": guild.Id,
+		"days":  days,
+		"gains": gains,
+	})
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// rolloutCommand runs the rollout helper instead of the app, see runRollout.
+const rolloutCommand = "selfupdate-rollout"
+
+// status values of the "selfupdate_events" collection.
+const (
+	rolloutPending    = "pending"
+	rolloutHealthy    = "healthy"
+	rolloutRolledBack = "rolled_back"
+	rolloutFailed     = "failed"
+)
+
+// containerInspect is the part of a Docker container inspect needed to recreate the container,
+// the config is passed through as is.
+type containerInspect struct {
+	ID         string         `json:"Id"`
+	Name       string         `json:"Name"`
+	Image      string         `json:"Image"`
+	Config     map[string]any `json:"Config"`
+	HostConfig map[string]any `json:"HostConfig"`
+	State      struct {
+		Running bool   `json:"Running"`
+		Status  string `json:"Status"`
+	} `json:"State"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Name        string `json:"Name"`
+		Destination string `json:"Destination"`
+		RW          bool   `json:"RW"`
+	} `json:"Mounts"`
+	NetworkSettings struct {
+		Networks map[string]containerNetwork `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// containerNetwork is the endpoint of a container in a network.
+type containerNetwork struct {
+	IPAddress  string          `json:"IPAddress"`
+	Aliases    []string        `json:"Aliases"`
+	Links      []string        `json:"Links"`
+	IPAMConfig json.RawMessage `json:"IPAMConfig"`
+}
+
+// primaryNetwork returns the network the container was created in, empty for the networks
+// Docker doesn't accept endpoint settings for (host, none, the default bridge or another container's network).
+func (c *containerInspect) primaryNetwork() string {
+	mode, _ := c.HostConfig["NetworkMode"].(string)
+	switch {
+	case mode == "host", mode == "none", mode == "bridge", mode == "default", strings.HasPrefix(mode, "container:"):
+		return ""
+	}
+	return mode
+}
+
+// endpointConfig returns the endpoint settings to attach a replacement of the container to a network, the aliases
+// Docker added for the short ID of the container itself are left out, the replacement gets its own.
+func (c *containerInspect) endpointConfig(network containerNetwork) map[string]any {
+	aliases := make([]string, 0, len(network.Aliases))
+	for _, alias := range network.Aliases {
+		if !strings.HasPrefix(c.ID, alias) {
+			aliases = append(aliases, alias)
+		}
+	}
+	config := map[string]any{"Aliases": aliases, "Links": network.Links}
+	if len(network.IPAMConfig) > 0 && string(network.IPAMConfig) != "null" {
+		config["IPAMConfig"] = network.IPAMConfig
+	}
+	return config
+}
+
+// binds returns the bind and volume mounts of the container, volumes that are only declared by the image
+// (anonymous volumes) are added by name, so the replacement keeps their data instead of getting new ones.
+func (c *containerInspect) binds() []string {
+	var binds []string
+	mounted := map[string]bool{}
+	if existing, ok := c.HostConfig["Binds"].([]any); ok {
+		for _, bind := range existing {
+			if bind, ok := bind.(string); ok {
+				binds = append(binds, bind)
+				if parts := strings.Split(bind, ":"); len(parts) > 1 {
+					mounted[parts[1]] = true
+				}
+			}
+		}
+	}
+	if mounts, ok := c.HostConfig["Mounts"].([]any); ok {
+		for _, mount := range mounts {
+			if mount, ok := mount.(map[string]any); ok {
+				if target, ok := mount["Target"].(string); ok {
+					mounted[target] = true
+				}
+			}
+		}
+	}
+	for _, mount := range c.Mounts {
+		if mount.Type != "volume" || mount.Name == "" || mounted[mount.Destination] {
+			continue
+		}
+		bind := mount.Name + ":" + mount.Destination
+		if !mount.RW {
+			bind += ":ro"
+		}
+		binds = append(binds, bind)
+	}
+	return binds
+}
+
+// dockerAPI sends a JSON request to the Docker Engine API and decodes the response into dst if it isn't nil.
+// A 304 answer (container already started or stopped) counts as success.
+func dockerAPI(ctx context.Context, method, path string, body any, dst any) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://localhost"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := dockerHTTPClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("docker request %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		raw, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("docker request %s %s failed (%d): %s", method, path, resp.StatusCode, raw)
+	}
+	if dst != nil {
+		if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+			return fmt.Errorf("failed to decode docker response: %w", err)
+		}
+	}
+	return nil
+}
+
+func inspectContainer(ctx context.Context, containerID string) (*containerInspect, error) {
+	container := &containerInspect{}
+	if err := dockerAPI(ctx, "GET", "/containers/"+containerID+"/json", nil, container); err != nil {
+		return nil, err
+	}
+	return container, nil
+}
+
+// inspectImage returns the image ID and the repo digest of a local image, the digest is empty for local builds.
+func inspectImage(ctx context.Context, cfg updateConfig, ref string) (string, string, error) {
+	var image struct {
+		ID          string   `json:"Id"`
+		RepoDigests []string `json:"RepoDigests"`
+	}
+	if err := dockerAPI(ctx, "GET", "/images/"+ref+"/json", nil, &image); err != nil {
+		return "", "", err
+	}
+	for _, d := range image.RepoDigests {
+		if name, digest, ok := strings.Cut(d, "@"); ok && cfg.matchesImage(name) {
+			return image.ID, digest, nil
+		}
+	}
+	return image.ID, "", nil
+}
+
+// createContainer creates a container with the config, volumes and networks of an existing one on another image.
+// The hostname is left to Docker, it defaults to the short ID of the new container.
+func createContainer(ctx context.Context, template *containerInspect, image, name string) (string, error) {
+	config := maps.Clone(template.Config)
+	config["Image"] = image
+	delete(config, "Hostname")
+	hostConfig := maps.Clone(template.HostConfig)
+	hostConfig["Binds"] = template.binds()
+	config["HostConfig"] = hostConfig
+
+	// a container is created in a single network, the others are connected afterwards
+	primary := template.primaryNetwork()
+	endpoints := map[string]any{}
+	if network, ok := template.NetworkSettings.Networks[primary]; ok {
+		endpoints[primary] = template.endpointConfig(network)
+	}
+	config["NetworkingConfig"] = map[string]any{"EndpointsConfig": endpoints}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := dockerAPI(ctx, "POST", "/containers/create?name="+url.QueryEscape(name), config, &created); err != nil {
+		return "", err
+	}
+	if primary == "" {
+		return created.ID, nil
+	}
+	for networkName, network := range template.NetworkSettings.Networks {
+		if networkName == primary {
+			continue
+		}
+		connect := map[string]any{"Container": created.ID, "EndpointConfig": template.endpointConfig(network)}
+		if err := dockerAPI(ctx, "POST", "/networks/"+url.PathEscape(networkName)+"/connect", connect, nil); err != nil {
+			if removeErr := removeContainer(ctx, created.ID); removeErr != nil {
+				log.Printf("[selfupdate] Error removing container: %v", removeErr)
+			}
+			return "", err
+		}
+	}
+	return created.ID, nil
+}
+
+func startContainer(ctx context.Context, containerID string) error {
+	return dockerAPI(ctx, "POST", "/containers/"+containerID+"/start", nil, nil)
+}
+
+func stopContainer(ctx context.Context, containerID string) error {
+	return dockerAPI(ctx, "POST", "/containers/"+containerID+"/stop?t=10", nil, nil)
+}
+
+func removeContainer(ctx context.Context, containerID string) error {
+	return dockerAPI(ctx, "DELETE", "/containers/"+containerID+"?force=true", nil, nil)
+}
+
+func renameContainer(ctx context.Context, containerID, name string) error {
+	return dockerAPI(ctx, "POST", "/containers/"+containerID+"/rename?name="+url.QueryEscape(name), nil, nil)
+}
+
+// startRollout records a pending "selfupdate_events" record and hands the rollout of the pulled image over to
+// a helper container running the current (known good) image, because replacing our own container stops this process.
+func startRollout(ctx context.Context, app core.App, cfg updateConfig, containerID, reference, newDigest string) error {
+	self, err := inspectContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	_, previousDigest, err := inspectImage(ctx, cfg, self.Image)
+	if err != nil {
+		return err
+	}
+	newImageID, _, err := inspectImage(ctx, cfg, cfg.imageRef(reference))
+	if err != nil {
+		return err
+	}
+
+	collection, err := app.FindCollectionByNameOrId("selfupdate_events")
+	if err != nil {
+		return err
+	}
+	token := core.GenerateDefaultRandomId() + core.GenerateDefaultRandomId()
+	event := core.NewRecord(collection)
+	event.Set("image", cfg.image)
+	event.Set("reference", reference)
+	event.Set("container", containerID)
+	event.Set("previous_digest", previousDigest)
+	event.Set("new_digest", newDigest)
+	event.Set("previous_image_id", self.Image)
+	event.Set("new_image_id", newImageID)
+	event.Set("status", rolloutPending)
+	event.Set("token", token)
+	if err := app.Save(event); err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		executable = "./blizbase"
+	}
+	helper := map[string]any{
+		"Image": self.Image,
+		"Cmd": []string{
+			executable, rolloutCommand,
+			"-container", containerID,
+			"-image", cfg.imageRef(reference),
+			"-event", event.Id,
+			"-token", token,
+			"-timeout", (time.Duration(envInt("SELFUPDATE_HEALTH_TIMEOUT", 180)) * time.Second).String(),
+			"-port", fmt.Sprint(envInt("SELFUPDATE_HEALTH_PORT", 8090)),
+		},
+		"HostConfig": map[string]any{
+			"Binds":       []string{dockerSocketPath + ":" + dockerSocketPath},
+			"AutoRemove":  true,
+			"NetworkMode": self.HostConfig["NetworkMode"],
+		},
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err = dockerAPI(ctx, "POST", "/containers/create", helper, &created)
+	if err == nil {
+		err = startContainer(ctx, created.ID)
+	}
+	if err != nil {
+		event.Set("status", rolloutFailed)
+		event.Set("message", "failed to start the rollout helper: "+err.Error())
+		event.Set("token", "")
+		if saveErr := app.Save(event); saveErr != nil {
+			log.Printf("[selfupdate] Error saving rollout event: %v", saveErr)
+		}
+		return err
+	}
+	log.Printf("[selfupdate] Rollout %s handed over to helper container %s.", event.Id, created.ID[:12])
+	return nil
+}
+
+// runRollout is the rollout helper: it creates a replacement of the app container on the new image, stops and renames
+// the old container and starts the replacement. The old container is only removed once the replacement answers its
+// health endpoint, otherwise the replacement is removed and the old container is started again.
+// The outcome is reported to the "selfupdate_events" record of the container that ends up running.
+func runRollout(args []string) int {
+	flags := flag.NewFlagSet(rolloutCommand, flag.ContinueOnError)
+	containerID := flags.String("container", "", "ID of the app container to update")
+	image := flags.String("image", "", "image to roll out")
+	eventID := flags.String("event", "", "selfupdate_events record of the rollout")
+	token := flags.String("token", "", "token authorizing the rollout result")
+	timeout := flags.Duration("timeout", 3*time.Minute, "time the new container has to turn healthy")
+	port := flags.Int("port", 8090, "port the app serves on inside the container")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *containerID == "" || *image == "" {
+		log.Printf("[selfupdate] -container and -image are required")
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2**timeout+5*time.Minute)
+	defer cancel()
+
+	old, err := inspectContainer(ctx, *containerID)
+	if err != nil {
+		log.Printf("[selfupdate] Error inspecting container: %v", err)
+		return 1
+	}
+	name := strings.TrimPrefix(old.Name, "/")
+	result := rolloutResult{event: *eventID, token: *token, port: *port}
+
+	// leftovers of an interrupted rollout would block the names
+	for _, leftover := range []string{name + "-update", name + "-previous"} {
+		if err := removeContainer(ctx, leftover); err == nil {
+			log.Printf("[selfupdate] Removed leftover container %s.", leftover)
+		}
+	}
+
+	log.Printf("[selfupdate] Creating replacement of %s on %s...", name, *image)
+	newID, err := createContainer(ctx, old, *image, name+"-update")
+	if err != nil {
+		log.Printf("[selfupdate] Error creating replacement: %v", err)
+		result.report(ctx, old.ID, rolloutFailed, err.Error())
+		return 1
+	}
+
+	if err := stopContainer(ctx, old.ID); err != nil {
+		log.Printf("[selfupdate] Error stopping container: %v", err)
+		if err := removeContainer(ctx, newID); err != nil {
+			log.Printf("[selfupdate] Error removing replacement: %v", err)
+		}
+		result.report(ctx, old.ID, rolloutFailed, err.Error())
+		return 1
+	}
+	err = renameContainer(ctx, old.ID, name+"-previous")
+	if err == nil {
+		err = renameContainer(ctx, newID, name)
+	}
+	if err == nil {
+		err = startContainer(ctx, newID)
+	}
+	if err == nil {
+		err = waitHealthy(ctx, newID, *port, *timeout)
+	}
+	if err == nil {
+		log.Printf("[selfupdate] %s is healthy on the new image, removing the old container.", name)
+		if err := removeContainer(ctx, old.ID); err != nil {
+			log.Printf("[selfupdate] Error removing old container: %v", err)
+		}
+		result.report(ctx, newID, rolloutHealthy, "")
+		return 0
+	}
+
+	log.Printf("[selfupdate] Rollout failed, rolling back: %v", err)
+	reason := err.Error()
+	if err := removeContainer(ctx, newID); err != nil {
+		log.Printf("[selfupdate] Error removing replacement: %v", err)
+	}
+	err = renameContainer(ctx, old.ID, name)
+	if err == nil {
+		err = startContainer(ctx, old.ID)
+	}
+	if err == nil {
+		err = waitHealthy(ctx, old.ID, *port, *timeout)
+	}
+	if err != nil {
+		log.Printf("[selfupdate] Rollback failed: %v", err)
+		return 1
+	}
+	result.report(ctx, old.ID, rolloutRolledBack, reason)
+	return 1
+}
+
+// containerAddress returns the address the app in a container listens on, as seen from the helper container
+// which shares its network.
+func containerAddress(container *containerInspect, port int) string {
+	if network, ok := container.NetworkSettings.Networks[container.primaryNetwork()]; ok && network.IPAddress != "" {
+		return fmt.Sprintf("http://%s:%d", network.IPAddress, port)
+	}
+	for _, network := range container.NetworkSettings.Networks {
+		if network.IPAddress != "" {
+			return fmt.Sprintf("http://%s:%d", network.IPAddress, port)
+		}
+	}
+	// host networking
+	return fmt.Sprintf("http://127.0.0.1:%d", port)
+}
+
+// waitHealthy polls the health endpoint of a container until it answers 200 or the timeout passes.
+func waitHealthy(ctx context.Context, containerID string, port int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	client := &http.Client{Timeout: 5 * time.Second}
+	for {
+		container, err := inspectContainer(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		if !container.State.Running && container.State.Status != "created" {
+			return fmt.Errorf("container is %s", container.State.Status)
+		}
+		resp, err := client.Get(containerAddress(container, port) + "/api/blizbase/health")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not healthy after %s", timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// rolloutResult reports the outcome of a rollout to the app.
+type rolloutResult struct {
+	event string
+	token string
+	port  int
+}
+
+func (r rolloutResult) report(ctx context.Context, containerID, status, message string) {
+	if r.event == "" {
+		return
+	}
+	container, err := inspectContainer(ctx, containerID)
+	if err != nil {
+		log.Printf("[selfupdate] Error reporting rollout result: %v", err)
+		return
+	}
+	raw, _ := json.Marshal(map[string]string{"token": r.token, "status": status, "message": message})
+	req, err := http.NewRequestWithContext(ctx, "POST", containerAddress(container, r.port)+"/api/blizbase/selfupdate/events/"+r.event+"/result", bytes.NewReader(raw))
+	if err != nil {
+		log.Printf("[selfupdate] Error reporting rollout result: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("[selfupdate] Error reporting rollout result: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("[selfupdate] Reporting rollout result failed (%d)", resp.StatusCode)
+	}
+}
+
+// healthCheck answers the health polls of the rollout helper, the app is healthy once it serves and its database answers.
+func healthCheck(e *core.RequestEvent) error {
+	var one int
+	if err := e.App.DB().NewQuery("SELECT 1").Row(&one); err != nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"status": "unhealthy"})
+	}
+	return e.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// rolloutResultHandler stores the outcome the rollout helper reports for a pending "selfupdate_events" record,
+// authorized by the token the record was created with.
+func rolloutResultHandler(e *core.RequestEvent) error {
+	var body struct {
+		Token   string `json:"token"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid rollout result.", err)
+	}
+	event, err := e.App.FindRecordById("selfupdate_events", e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Rollout not found.", err)
+	}
+	token := event.GetString("token")
+	if event.GetString("status") != rolloutPending || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(body.Token)) != 1 {
+		return e.ForbiddenError("Invalid rollout token.", nil)
+	}
+	if body.Status != rolloutHealthy && body.Status != rolloutRolledBack && body.Status != rolloutFailed {
+		return e.BadRequestError("Invalid status value.", nil)
+	}
+
+	event.Set("status", body.Status)
+	event.Set("message", body.Message)
+	event.Set("token", "")
+	if err := e.App.Save(event); err != nil {
+		return e.InternalServerError("Failed to save the rollout result.", err)
+	}
+	log.Printf("[selfupdate] Rollout %s finished: %s %s", event.Id, body.Status, body.Message)
+	return e.JSON(http.StatusOK, map[string]string{"status": body.Status})
+}
+
+// rolloutRunning reports whether a rollout is still waiting for the result of its helper.
+func rolloutRunning(app core.App) bool {
+	_, err := app.FindFirstRecordByData("selfupdate_events", "status", rolloutPending)
+	return err == nil
+}
+
+// rolledBack reports whether a rollout of the digest was rolled back because the new container wasn't healthy.
+func rolledBack(app core.App, digest string) bool {
+	_, err := app.FindFirstRecordByFilter("selfupdate_events", "new_digest = {:digest} && status = {:status}", dbx.Params{"digest": digest, "status": rolloutRolledBack})
+	return err == nil
+}
+
+// failStaleRollouts marks rollouts that never reported a result as failed, e.g. because the rollback failed too.
+func failStaleRollouts(app core.App) {
+	cutoff := types.NowDateTime().Add(-time.Hour)
+	events, err := app.FindRecordsByFilter("selfupdate_events", "status = {:status} && created < {:cutoff}", "", 0, 0, dbx.Params{"status": rolloutPending, "cutoff": cutoff.String()})
+	if err != nil {
+		log.Printf("[selfupdate] Error finding pending rollouts: %v", err)
+		return
+	}
+	for _, event := range events {
+		event.Set("status", rolloutFailed)
+		event.Set("message", "no rollout result reported")
+		event.Set("token", "")
+		if err := app.Save(event); err != nil {
+			log.Printf("[selfupdate] Error saving rollout event: %v", err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,74 +9,110 @@ import (
 	"log"
 	"net"
 	"net/http"
-	"os/exec"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/pocketbase/pocketbase/core"
 )
 
 const (
-	ghcrImage        = "ghcr.io/jrsmile/blizbase"
-	ghcrTag          = "latest"
-	ghcrImageRef     = ghcrImage + ":" + ghcrTag
-	ghcrRegistryURL  = "https://ghcr.io"
+	defaultImage     = "ghcr.io/jrsmile/blizbase"
+	defaultTag       = "latest"
 	dockerSocketPath = "/var/run/docker.sock"
 )
 
-// dockerHTTPClient creates an HTTP client that talks to the Docker daemon via Unix socket.
-func dockerHTTPClient() *http.Client {
-	return &http.Client{
-		Transport: &http.Transport{
-			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
-				return net.Dial("unix", dockerSocketPath)
-			},
-		},
-		Timeout: 120 * time.Second,
-	}
+// updateConfig is the image the self-update follows, set with SELFUPDATE_IMAGE (defaults to ghcr.io/jrsmile/blizbase),
+// SELFUPDATE_TAG (defaults to latest), SELFUPDATE_REGISTRY (defaults to the registry of the image) and SELFUPDATE_CHANNEL.
+type updateConfig struct {
+	image    string // image name without tag, e.g. ghcr.io/jrsmile/blizbase
+	host     string // registry host of the image, e.g. ghcr.io
+	repo     string // repository on the registry, e.g. jrsmile/blizbase
+	registry string // registry API base url, e.g. https://ghcr.io
+	tag      string
+	// channel selects the followed version: empty follows tag, "stable" the newest release,
+	// "v1.x" or "v1.2.x" the newest release of a major or minor version and "sha256:..." pins a digest.
+	channel string
 }
 
-// getGHCRToken fetches an anonymous bearer token for pulling public image manifests from GHCR.
-func getGHCRToken(ctx context.Context, repo string) (string, error) {
-	tokenURL := fmt.Sprintf("https://ghcr.io/token?scope=repository:%s:pull&service=ghcr.io", repo)
-	req, err := http.NewRequestWithContext(ctx, "GET", tokenURL, nil)
-	if err != nil {
-		return "", err
+func loadUpdateConfig() updateConfig {
+	cfg := updateConfig{
+		image:   cmp.Or(goDotEnvVariable("SELFUPDATE_IMAGE"), defaultImage),
+		tag:     cmp.Or(goDotEnvVariable("SELFUPDATE_TAG"), defaultTag),
+		channel: goDotEnvVariable("SELFUPDATE_CHANNEL"),
 	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to request GHCR token: %w", err)
+	// a tag or digest given with the image wins over SELFUPDATE_TAG and SELFUPDATE_CHANNEL
+	if image, digest, ok := strings.Cut(cfg.image, "@"); ok {
+		cfg.image, cfg.channel = image, digest
+	}
+	if i := strings.LastIndex(cfg.image, ":"); i > strings.LastIndex(cfg.image, "/") {
+		cfg.image, cfg.tag = cfg.image[:i], cfg.image[i+1:]
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("GHCR token request failed (%d): %s", resp.StatusCode, body)
+	cfg.host, cfg.repo = "docker.io", cfg.image
+	if host, repo, ok := strings.Cut(cfg.image, "/"); ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		cfg.host, cfg.repo = host, repo
+	} else if !strings.Contains(cfg.repo, "/") {
+		cfg.repo = "library/" + cfg.repo
 	}
 
-	var tokenResp struct {
-		Token string `json:"token"`
+	registry := goDotEnvVariable("SELFUPDATE_REGISTRY")
+	switch {
+	case registry == "" && cfg.host == "docker.io":
+		registry = "https://registry-1.docker.io"
+	case registry == "":
+		registry = "https://" + cfg.host
+	case !strings.Contains(registry, "://"):
+		registry = "https://" + registry
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return "", fmt.Errorf("failed to decode token response: %w", err)
+	cfg.registry = strings.TrimSuffix(registry, "/")
+	return cfg
+}
+
+// pinned reports whether the channel pins a digest, the update then only pulls that digest once.
+func (cfg updateConfig) pinned() bool {
+	return strings.HasPrefix(cfg.channel, "sha256:")
+}
+
+// imageRef returns the image reference of a tag or digest as used by the Docker daemon.
+func (cfg updateConfig) imageRef(reference string) string {
+	if strings.HasPrefix(reference, "sha256:") {
+		return cfg.image + "@" + reference
 	}
-	return tokenResp.Token, nil
+	return cfg.image + ":" + reference
 }
 
-// getRemoteDigest queries the GHCR registry v2 API for the current digest of the :latest tag.
-func getRemoteDigest(ctx context.Context) (string, error) {
-	repo := strings.TrimPrefix(ghcrImage, "ghcr.io/")
+// matchesImage reports whether a local image name (as listed by the Docker daemon) is the configured image,
+// Docker Hub images are listed without the docker.io/ and library/ prefixes.
+func (cfg updateConfig) matchesImage(name string) bool {
+	short := func(image string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(image, "docker.io/"), "library/")
+	}
+	return short(name) == short(cfg.image)
+}
 
-	token, err := getGHCRToken(ctx, repo)
-	if err != nil {
-		return "", err
+// dockerHTTPClient creates an HTTP client that talks to the Docker daemon via Unix socket.
+func dockerHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", dockerSocketPath)
+			},
+		},
+		Timeout: 120 * time.Second,
 	}
+}
 
-	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", ghcrRegistryURL, repo, ghcrTag)
+// getRemoteDigest queries the registry v2 API for the current digest of a tag.
+func getRemoteDigest(ctx context.Context, registry *registryClient, tag string) (string, error) {
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", registry.cfg.registry, registry.cfg.repo, tag)
 	req, err := http.NewRequestWithContext(ctx, "HEAD", manifestURL, nil)
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", strings.Join([]string{
 		"application/vnd.docker.distribution.manifest.v2+json",
 		"application/vnd.docker.distribution.manifest.list.v2+json",
@@ -83,7 +120,7 @@ func getRemoteDigest(ctx context.Context) (string, error) {
 		"application/vnd.oci.image.index.v1+json",
 	}, ", "))
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := registry.do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch remote manifest: %w", err)
 	}
@@ -101,12 +138,152 @@ func getRemoteDigest(ctx context.Context) (string, error) {
 	return digest, nil
 }
 
-// getLocalDigest inspects the locally pulled image via the Docker Engine API
+// listTags returns all tags of the image repository, following the pagination of the registry.
+func listTags(ctx context.Context, registry *registryClient) ([]string, error) {
+	var tags []string
+	next := fmt.Sprintf("%s/v2/%s/tags/list?n=1000", registry.cfg.registry, registry.cfg.repo)
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, "GET", next, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := registry.do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("tag list request failed (%d): %s", resp.StatusCode, body)
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode tag list: %w", err)
+		}
+		tags = append(tags, page.Tags...)
+
+		// the next page is announced as Link: </v2/<repo>/tags/list?n=1000&last=v1.2.3>; rel="next"
+		next = ""
+		if link, _, ok := strings.Cut(resp.Header.Get("Link"), ";"); ok {
+			if linkURL, err := resp.Request.URL.Parse(strings.Trim(strings.TrimSpace(link), "<>")); err == nil {
+				next = linkURL.String()
+			}
+		}
+	}
+	return tags, nil
+}
+
+// semver is a release tag like v1.2.3 or 1.2.3-rc.1.
+type semver struct {
+	major, minor, patch int
+	prerelease          string
+}
+
+func parseSemver(tag string) (semver, bool) {
+	version, _, _ := strings.Cut(strings.TrimPrefix(tag, "v"), "+")
+	version, prerelease, _ := strings.Cut(version, "-")
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		numbers[i] = n
+	}
+	return semver{major: numbers[0], minor: numbers[1], patch: numbers[2], prerelease: prerelease}, true
+}
+
+// compare orders versions by precedence, a prerelease comes before its release.
+func (v semver) compare(other semver) int {
+	if c := cmp.Compare(v.major, other.major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.minor, other.minor); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.patch, other.patch); c != 0 {
+		return c
+	}
+	switch {
+	case v.prerelease == other.prerelease:
+		return 0
+	case v.prerelease == "":
+		return 1
+	case other.prerelease == "":
+		return -1
+	}
+	return strings.Compare(v.prerelease, other.prerelease)
+}
+
+// channelFilter returns the check whether a release belongs to a semver channel ("stable", "v1.x", "v1.2.x").
+func channelFilter(channel string) (func(semver) bool, error) {
+	if channel == "stable" {
+		return func(v semver) bool { return v.prerelease == "" }, nil
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(channel, "v"), ".x"), ".")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("invalid update channel %q", channel)
+	}
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid update channel %q", channel)
+		}
+		numbers[i] = n
+	}
+	return func(v semver) bool {
+		return v.prerelease == "" && v.major == numbers[0] && (len(numbers) == 1 || v.minor == numbers[1])
+	}, nil
+}
+
+// resolveTag returns the tag the configured channel currently points to,
+// the newest matching release for semver channels or the configured tag otherwise.
+func resolveTag(ctx context.Context, registry *registryClient) (string, error) {
+	cfg := registry.cfg
+	if cfg.channel == "" || cfg.channel == "tag" {
+		return cfg.tag, nil
+	}
+	matches, err := channelFilter(cfg.channel)
+	if err != nil {
+		return "", err
+	}
+	tags, err := listTags(ctx, registry)
+	if err != nil {
+		return "", err
+	}
+	newestTag := ""
+	var newest semver
+	for _, tag := range tags {
+		version, ok := parseSemver(tag)
+		if !ok || !matches(version) {
+			continue
+		}
+		if newestTag == "" || version.compare(newest) > 0 {
+			newest, newestTag = version, tag
+		}
+	}
+	if newestTag == "" {
+		return "", fmt.Errorf("no tag of %s matches channel %q", cfg.image, cfg.channel)
+	}
+	return newestTag, nil
+}
+
+// getLocalDigest inspects the locally pulled image of a tag or digest via the Docker Engine API
 // and returns its repo digest (e.g. sha256:abc...).
-func getLocalDigest(ctx context.Context) (string, error) {
+func getLocalDigest(ctx context.Context, cfg updateConfig, reference string) (string, error) {
 	client := dockerHTTPClient()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://localhost/images/"+ghcrImageRef+"/json", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://localhost/images/"+cfg.imageRef(reference)+"/json", nil)
 	if err != nil {
 		return "", err
 	}
@@ -133,22 +310,25 @@ func getLocalDigest(ctx context.Context) (string, error) {
 	}
 
 	for _, d := range imageInfo.RepoDigests {
-		if strings.HasPrefix(d, ghcrImage+"@") {
-			return strings.TrimPrefix(d, ghcrImage+"@"), nil
+		if name, digest, ok := strings.Cut(d, "@"); ok && cfg.matchesImage(name) {
+			return digest, nil
 		}
 	}
 	return "", nil
 }
 
-// pullImage tells the Docker daemon to pull the latest image from GHCR.
-func pullImage(ctx context.Context) error {
+// pullImage tells the Docker daemon to pull a tag or digest of the image, with the registry credentials if there are any.
+func pullImage(ctx context.Context, cfg updateConfig, credentials registryCredentials, reference string) error {
 	client := dockerHTTPClient()
 
-	url := fmt.Sprintf("http://localhost/images/create?fromImage=%s&tag=%s", ghcrImage, ghcrTag)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	query := url.Values{"fromImage": {cfg.image}, "tag": {reference}}
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://localhost/images/create?"+query.Encode(), nil)
 	if err != nil {
 		return err
 	}
+	if auth := credentials.dockerAuthHeader(cfg); auth != "" {
+		req.Header.Set("X-Registry-Auth", auth)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -179,12 +359,12 @@ func pullImage(ctx context.Context) error {
 	return nil
 }
 
-// getContainerID returns the ID of the running container using the given image.
-func getContainerID(ctx context.Context) (string, error) {
+// getContainerID returns the ID of the running container of the image, regardless of its tag.
+// Our own container is preferred, Docker uses the short container ID as its hostname.
+func getContainerID(ctx context.Context, cfg updateConfig) (string, error) {
 	client := dockerHTTPClient()
 
-	req, err := http.NewRequestWithContext(ctx, "GET",
-		"http://localhost/containers/json?filters="+`{"ancestor":["`+ghcrImageRef+`"]}`, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://localhost/containers/json", nil)
 	if err != nil {
 		return "", err
 	}
@@ -201,99 +381,159 @@ func getContainerID(ctx context.Context) (string, error) {
 	}
 
 	var containers []struct {
-		Id string `json:"Id"`
+		Id    string `json:"Id"`
+		Image string `json:"Image"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
 		return "", fmt.Errorf("failed to decode container list: %w", err)
 	}
 
-	if len(containers) == 0 {
-		return "", nil
+	// a container rolled back to an untagged image is only listed with the image ID
+	hostname, _ := os.Hostname()
+	containerID := ""
+	for _, container := range containers {
+		if hostname != "" && strings.HasPrefix(container.Id, hostname) {
+			return container.Id, nil
+		}
+		name, _, _ := strings.Cut(container.Image, "@")
+		if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+			name = name[:i]
+		}
+		if containerID == "" && cfg.matchesImage(name) {
+			containerID = container.Id
+		}
 	}
-	return containers[0].Id, nil
+	return containerID, nil
 }
 
-// restartContainer sends a restart request to the Docker daemon for the given container.
-func restartContainer(ctx context.Context, containerID string) error {
-	client := dockerHTTPClient()
+// updateCheck is the outcome of a self-update run.
+type updateCheck struct {
+	result       string
+	reference    string
+	localDigest  string
+	remoteDigest string
+}
 
-	url := fmt.Sprintf("http://localhost/containers/%s/restart?t=10", containerID)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
-	if err != nil {
-		return err
+// selfUpdateRunning prevents a manual check or update from overlapping with the SelfUpdate cron.
+var selfUpdateRunning atomic.Bool
+
+// watchForUpdates resolves the image version of the configured channel, pulls it if it differs from
+// the local image, and rolls it out to the running container. Scheduled runs skip the update while paused
+// or outside the maintenance window of the "selfupdate_settings" record, which stores the outcome.
+func watchForUpdates(app core.App, mode updateMode) (*updateCheck, error) {
+	if !selfUpdateRunning.CompareAndSwap(false, true) {
+		return nil, errUpdateRunning
 	}
+	defer selfUpdateRunning.Store(false)
+	return runUpdate(app, mode)
+}
 
-	resp, err := client.Do(req)
+// runUpdate is watchForUpdates for callers that already claimed selfUpdateRunning.
+func runUpdate(app core.App, mode updateMode) (*updateCheck, error) {
+	settings, err := findSelfUpdateSettings(app)
 	if err != nil {
-		return fmt.Errorf("failed to restart container: %w", err)
+		return nil, fmt.Errorf("failed to load the self-update settings: %w", err)
 	}
-	defer resp.Body.Close()
+	check := &updateCheck{}
+	err = checkForUpdates(app, settings, mode, check)
+	saveUpdateCheck(app, settings, check, err)
+	return check, err
+}
 
-	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("restart failed (%d): %s", resp.StatusCode, body)
+func checkForUpdates(app core.App, settings *core.Record, mode updateMode, check *updateCheck) error {
+	if mode == updateScheduled && settings.GetBool("paused") {
+		log.Println("[selfupdate] Automatic updates are paused.")
+		check.result = updatePaused
+		return nil
 	}
-	return nil
-}
 
-// watchForUpdates checks the GHCR registry for a newer image digest,
-// pulls it if changed, and optionally restarts the running container.
-// Designed to be called periodically via cron.
-func watchForUpdates() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	log.Println("[selfupdate] Checking for image updates...")
+	cfg := loadUpdateConfig()
+	registry := newRegistryClient(cfg)
+	log.Printf("[selfupdate] Checking for image updates of %s...", cfg.image)
+
+	// a pinned digest is already the remote version, otherwise the channel is resolved to a tag first
+	check.reference, check.remoteDigest = cfg.channel, cfg.channel
+	if !cfg.pinned() {
+		var err error
+		check.reference, err = resolveTag(ctx, registry)
+		if err != nil {
+			return fmt.Errorf("error resolving update channel: %w", err)
+		}
+		check.remoteDigest, err = getRemoteDigest(ctx, registry, check.reference)
+		if err != nil {
+			return fmt.Errorf("error checking remote digest: %w", err)
+		}
+	}
+	log.Printf("[selfupdate] Remote digest of %s: %s", cfg.imageRef(check.reference), check.remoteDigest)
 
-	remoteDigest, err := getRemoteDigest(ctx)
+	// the image of the running container is compared rather than the local image of the tag, after a rolled back
+	// update the tag already points to the new image while the container still runs the previous one
+	containerID, err := getContainerID(ctx, cfg)
 	if err != nil {
-		log.Printf("[selfupdate] Error checking remote digest: %v", err)
-		return
+		return fmt.Errorf("error finding container: %w", err)
 	}
-	log.Printf("[selfupdate] Remote digest: %s", remoteDigest)
-
-	localDigest, err := getLocalDigest(ctx)
+	imageDigest, err := getLocalDigest(ctx, cfg, check.reference)
 	if err != nil {
-		log.Printf("[selfupdate] Error checking local digest: %v", err)
-		return
+		return fmt.Errorf("error checking local digest: %w", err)
+	}
+	check.localDigest = imageDigest
+	if containerID != "" {
+		container, err := inspectContainer(ctx, containerID)
+		if err != nil {
+			return fmt.Errorf("error inspecting container: %w", err)
+		}
+		if _, check.localDigest, err = inspectImage(ctx, cfg, container.Image); err != nil {
+			return fmt.Errorf("error checking running digest: %w", err)
+		}
 	}
-	log.Printf("[selfupdate] Local  digest: %s", localDigest)
+	log.Printf("[selfupdate] Local  digest: %s", check.localDigest)
 
-	if localDigest == remoteDigest {
+	if check.localDigest == check.remoteDigest {
 		log.Println("[selfupdate] Image is up to date.")
-		return
+		check.result = updateUpToDate
+		return nil
 	}
-
-	log.Println("[selfupdate] New image version detected, pulling...")
-	if err := pullImage(ctx); err != nil {
-		log.Printf("[selfupdate] Error pulling image: %v", err)
-		return
+	check.result = updateAvailable
+	if mode == updateCheckOnly {
+		return nil
+	}
+	if mode == updateScheduled && !inMaintenanceWindow(settings.GetString("maintenance_start"), settings.GetString("maintenance_end"), time.Now()) {
+		log.Printf("[selfupdate] New image version detected, waiting for the maintenance window %s-%s.", settings.GetString("maintenance_start"), settings.GetString("maintenance_end"))
+		return nil
+	}
+	failStaleRollouts(app)
+	if rolloutRunning(app) {
+		log.Println("[selfupdate] New image version detected, waiting for the running rollout.")
+		return nil
+	}
+	// an image that failed its health check is only rolled out again by a manual update
+	if mode == updateScheduled && rolledBack(app, check.remoteDigest) {
+		log.Printf("[selfupdate] New image version %s was rolled back before, waiting for a newer image or a manual update.", check.remoteDigest)
+		return nil
 	}
-	log.Println("[selfupdate] Successfully pulled new image.")
 
-	// Find and restart our own container so it picks up the new image.
-	containerID, err := getContainerID(ctx)
-	if err != nil {
-		log.Printf("[selfupdate] Error finding container: %v", err)
-		return
+	if imageDigest != check.remoteDigest {
+		log.Println("[selfupdate] New image version detected, pulling...")
+		if err := pullImage(ctx, cfg, registry.credentials, check.reference); err != nil {
+			return fmt.Errorf("error pulling image: %w", err)
+		}
+		log.Println("[selfupdate] Successfully pulled new image.")
 	}
+	check.result = updatePulled
+
+	// Replace our own container with one on the new image.
 	if containerID == "" {
-		log.Println("[selfupdate] No running container found for this image. Pull complete; manual restart needed.")
-		// execute shell command
-		cmd := exec.Command("docker-compose", "up", "-d")
-		if err := cmd.Run(); err != nil {
-			log.Printf("[selfupdate] Error executing shell command: %v", err)
-		}
-		return
+		log.Println("[selfupdate] No running container found for this image. Pull complete; manual recreate needed.")
+		return nil
 	}
 
-	log.Printf("[selfupdate] Restarting container %s...", containerID[:12])
-	if err := restartContainer(ctx, containerID); err != nil {
-		log.Printf("[selfupdate] Error restarting container: %v", err)
-		cmd := exec.Command("docker-compose", "up", "-d")
-		if err := cmd.Run(); err != nil {
-			log.Printf("[selfupdate] Error executing shell command: %v", err)
-		}
-		return
+	log.Printf("[selfupdate] Rolling out the new image to container %s...", containerID[:12])
+	if err := startRollout(ctx, app, cfg, containerID, check.reference, check.remoteDigest); err != nil {
+		return fmt.Errorf("error starting rollout: %w", err)
 	}
+	check.result = updateRolledOut
+	return nil
 }
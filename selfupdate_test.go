@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want semver
+		ok   bool
+	}{
+		{tag: "1.2.3", want: semver{major: 1, minor: 2, patch: 3}, ok: true},
+		{tag: "v1.2.3", want: semver{major: 1, minor: 2, patch: 3}, ok: true},
+		{tag: "v10.0.12", want: semver{major: 10, minor: 0, patch: 12}, ok: true},
+		{tag: "v1.2.3-rc.1", want: semver{major: 1, minor: 2, patch: 3, prerelease: "rc.1"}, ok: true},
+		{tag: "v1.2.3+build.5", want: semver{major: 1, minor: 2, patch: 3}, ok: true},
+		{tag: "v1.2.3-beta+build.5", want: semver{major: 1, minor: 2, patch: 3, prerelease: "beta"}, ok: true},
+		{tag: "latest"},
+		{tag: "v1.2"},
+		{tag: "v1.2.3.4"},
+		{tag: "v1.x.3"},
+		{tag: "v1.-2.3"},
+		{tag: ""},
+	}
+	for _, tt := range tests {
+		got, ok := parseSemver(tt.tag)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseSemver(%q) = %+v, %v, want %+v, %v", tt.tag, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "v1.2.3", b: "v1.2.3", want: 0},
+		{a: "v1.2.3", b: "v1.2.4", want: -1},
+		{a: "v1.3.0", b: "v1.2.9", want: 1},
+		{a: "v2.0.0", b: "v1.9.9", want: 1},
+		{a: "v1.2.3-rc.1", b: "v1.2.3", want: -1},
+		{a: "v1.2.3", b: "v1.2.3-rc.1", want: 1},
+		{a: "v1.2.3-alpha", b: "v1.2.3-beta", want: -1},
+		{a: "v1.2.3-rc.1", b: "v1.2.3-rc.1", want: 0},
+	}
+	for _, tt := range tests {
+		a, _ := parseSemver(tt.a)
+		b, _ := parseSemver(tt.b)
+		if got := a.compare(b); got != tt.want {
+			t.Errorf("%s compare %s = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestChannelFilter(t *testing.T) {
+	tests := []struct {
+		channel string
+		matches []string
+		skips   []string
+		invalid bool
+	}{
+		{channel: "stable", matches: []string{"v1.2.3", "v2.0.0"}, skips: []string{"v1.2.3-rc.1"}},
+		{channel: "v1.x", matches: []string{"v1.0.0", "v1.9.3"}, skips: []string{"v2.0.0", "v0.9.0", "v1.2.0-rc.1"}},
+		{channel: "1.x", matches: []string{"v1.4.0"}, skips: []string{"v2.4.0"}},
+		{channel: "v1.2.x", matches: []string{"v1.2.0", "v1.2.7"}, skips: []string{"v1.3.0", "v2.2.0", "v1.2.8-beta"}},
+		{channel: "v1.2.3.x", invalid: true},
+		{channel: "vx", invalid: true},
+		{channel: "beta", invalid: true},
+	}
+	for _, tt := range tests {
+		matches, err := channelFilter(tt.channel)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("channelFilter(%q) accepted an invalid channel", tt.channel)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("channelFilter(%q) failed: %v", tt.channel, err)
+			continue
+		}
+		for _, tag := range tt.matches {
+			if v, _ := parseSemver(tag); !matches(v) {
+				t.Errorf("channel %q doesn't match %s", tt.channel, tag)
+			}
+		}
+		for _, tag := range tt.skips {
+			if v, _ := parseSemver(tag); matches(v) {
+				t.Errorf("channel %q matches %s", tt.channel, tag)
+			}
+		}
+	}
+}
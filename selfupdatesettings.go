@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// defaultUpdateSchedule checks for a new image every 20 minutes (watchtower-like).
+const defaultUpdateSchedule = "*/20 * * * *"
+
+// last_result values of the "selfupdate_settings" record.
+const (
+	updatePaused    = "paused"
+	updateUpToDate  = "up_to_date"
+	updateAvailable = "update_available"
+	updatePulled    = "pulled"
+	updateRolledOut = "rolled_out"
+	updateError     = "error"
+)
+
+var updateResults = []string{updatePaused, updateUpToDate, updateAvailable, updatePulled, updateRolledOut, updateError}
+
+// updateMode is how a self-update run was started.
+type updateMode int
+
+const (
+	// updateScheduled is a run of the SelfUpdate cron, it honours the pause and the maintenance window.
+	updateScheduled updateMode = iota
+	// updateCheckOnly compares the digests without pulling.
+	updateCheckOnly
+	// updateNow applies an update regardless of the pause and the maintenance window.
+	updateNow
+)
+
+var errUpdateRunning = errors.New("self-update already running")
+
+// findSelfUpdateSettings returns the single "selfupdate_settings" record.
+func findSelfUpdateSettings(app core.App) (*core.Record, error) {
+	record := &core.Record{}
+	if err := app.RecordQuery("selfupdate_settings").Limit(1).One(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// scheduleSelfUpdate (re)registers the SelfUpdate cron with the schedule of the settings record.
+func scheduleSelfUpdate(app core.App) {
+	schedule := defaultUpdateSchedule
+	if settings, err := findSelfUpdateSettings(app); err == nil && settings.GetString("schedule") != "" {
+		schedule = settings.GetString("schedule")
+	}
+	job := func() {
+		if _, err := watchForUpdates(app, updateScheduled); err != nil {
+			log.Printf("[selfupdate] %v", err)
+		}
+	}
+	if err := app.Cron().Add("SelfUpdate", schedule, job); err != nil {
+		log.Printf("[selfupdate] Invalid schedule %q, using %q: %v", schedule, defaultUpdateSchedule, err)
+		app.Cron().MustAdd("SelfUpdate", defaultUpdateSchedule, job)
+	}
+}
+
+// parseClock parses a "15:04" time of day into minutes since midnight.
+func parseClock(value string) (int, bool) {
+	hours, minutes, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, false
+	}
+	h, err := strconv.Atoi(hours)
+	if err != nil || h < 0 || h > 23 {
+		return 0, false
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 || m > 59 {
+		return 0, false
+	}
+	return h*60 + m, true
+}
+
+// inMaintenanceWindow reports whether updates may be applied at the given time, in the local time of the server,
+// for the window between the "HH:MM" times start and end. Without a window updates are always applied,
+// a window may wrap midnight (e.g. 23:00 to 01:00).
+func inMaintenanceWindow(start, end string, now time.Time) bool {
+	startMinute, okStart := parseClock(start)
+	endMinute, okEnd := parseClock(end)
+	if !okStart || !okEnd {
+		return true
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute
+	}
+	return minute >= startMinute || minute < endMinute
+}
+
+// saveUpdateCheck stores the outcome of a self-update run on the settings record. The record is reloaded,
+// so changes a superuser made while the run was pulling or rolling out aren't overwritten.
+func saveUpdateCheck(app core.App, settings *core.Record, check *updateCheck, err error) {
+	settings, findErr := app.FindRecordById("selfupdate_settings", settings.Id)
+	if findErr != nil {
+		log.Printf("[selfupdate] Error saving check result: %v", findErr)
+		return
+	}
+	settings.Set("last_check", types.NowDateTime())
+	settings.Set("last_result", check.result)
+	settings.Set("last_error", "")
+	if err != nil {
+		settings.Set("last_result", updateError)
+		settings.Set("last_error", err.Error())
+	}
+	settings.Set("last_reference", check.reference)
+	settings.Set("local_digest", check.localDigest)
+	settings.Set("remote_digest", check.remoteDigest)
+	if err := app.Save(settings); err != nil {
+		log.Printf("[selfupdate] Error saving check result: %v", err)
+	}
+}
+
+// selfUpdateStatus returns the digest of the running container next to the result of the last check,
+// the settings and the recent rollouts.
+func selfUpdateStatus(e *core.RequestEvent) error {
+	settings, err := findSelfUpdateSettings(e.App)
+	if err != nil {
+		return e.InternalServerError("Failed to load the self-update settings.", err)
+	}
+	ctx, cancel := context.WithTimeout(e.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	cfg := loadUpdateConfig()
+	status := map[string]any{
+		"image":   cfg.image,
+		"tag":     cfg.tag,
+		"channel": cfg.channel,
+		"running": selfUpdateRunning.Load(),
+	}
+	// the docker socket may not be mounted, the status is still useful without the running container
+	if containerID, err := getContainerID(ctx, cfg); err == nil && containerID != "" {
+		status["container"] = containerID
+		if container, err := inspectContainer(ctx, containerID); err == nil {
+			if _, digest, err := inspectImage(ctx, cfg, container.Image); err == nil {
+				status["current_digest"] = digest
+			}
+		}
+	}
+	status["in_maintenance_window"] = inMaintenanceWindow(settings.GetString("maintenance_start"), settings.GetString("maintenance_end"), time.Now())
+	for _, field := range []string{"schedule", "paused", "maintenance_start", "maintenance_end", "last_check", "last_result", "last_error", "last_reference", "local_digest", "remote_digest"} {
+		status[field] = settings.Get(field)
+	}
+
+	events, err := e.App.FindRecordsByFilter("selfupdate_events", "", "-created", 5, 0)
+	if err != nil {
+		return e.InternalServerError("Failed to load the rollouts.", err)
+	}
+	status["rollouts"] = events
+	return e.JSON(http.StatusOK, status)
+}
+
+// selfUpdateCheck compares the local and the remote digest without pulling.
+func selfUpdateCheck(e *core.RequestEvent) error {
+	check, err := watchForUpdates(e.App, updateCheckOnly)
+	if errors.Is(err, errUpdateRunning) {
+		return e.Error(http.StatusConflict, "A self-update is already running.", nil)
+	}
+	if err != nil {
+		return e.InternalServerError("Self-update check failed.", err)
+	}
+	return e.JSON(http.StatusOK, map[string]any{
+		"result":        check.result,
+		"reference":     check.reference,
+		"local_digest":  check.localDigest,
+		"remote_digest": check.remoteDigest,
+	})
+}
+
+// selfUpdateNow applies an available update right away, regardless of the pause and the maintenance window.
+// Pulling takes a while, so it runs in the background, the outcome shows up in the status.
+func selfUpdateNow(e *core.RequestEvent) error {
+	// the run is claimed before answering, so a 202 always means this request's update runs
+	if !selfUpdateRunning.CompareAndSwap(false, true) {
+		return e.Error(http.StatusConflict, "A self-update is already running.", nil)
+	}
+	go func() {
+		defer selfUpdateRunning.Store(false)
+		if _, err := runUpdate(e.App, updateNow); err != nil {
+			log.Printf("[selfupdate] %v", err)
+		}
+	}()
+	return e.JSON(http.StatusAccepted, map[string]string{"status": "started"})
+}
+
+// selfUpdateSettings changes the schedule, the pause or the maintenance window, e.g.
+// {"paused": false, "maintenance_start": "04:00", "maintenance_end": "06:00"}. Empty times remove the window.
+func selfUpdateSettings(e *core.RequestEvent) error {
+	var body struct {
+		Schedule         *string `json:"schedule"`
+		Paused           *bool   `json:"paused"`
+		MaintenanceStart *string `json:"maintenance_start"`
+		MaintenanceEnd   *string `json:"maintenance_end"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid settings.", err)
+	}
+	settings, err := findSelfUpdateSettings(e.App)
+	if err != nil {
+		return e.InternalServerError("Failed to load the self-update settings.", err)
+	}
+
+	if body.Schedule != nil {
+		if _, err := cron.NewSchedule(*body.Schedule); err != nil {
+			return e.BadRequestError("Invalid schedule value.", err)
+		}
+		settings.Set("schedule", *body.Schedule)
+	}
+	if body.Paused != nil {
+		settings.Set("paused", *body.Paused)
+	}
+	if body.MaintenanceStart != nil {
+		settings.Set("maintenance_start", *body.MaintenanceStart)
+	}
+	if body.MaintenanceEnd != nil {
+		settings.Set("maintenance_end", *body.MaintenanceEnd)
+	}
+	if (settings.GetString("maintenance_start") == "") != (settings.GetString("maintenance_end") == "") {
+		return e.BadRequestError("The maintenance window needs a start and an end.", nil)
+	}
+	if err := e.App.Save(settings); err != nil {
+		return e.BadRequestError("Invalid settings.", err)
+	}
+	return e.JSON(http.StatusOK, settings)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value  string
+		minute int
+		ok     bool
+	}{
+		{value: "00:00", minute: 0, ok: true},
+		{value: "04:30", minute: 270, ok: true},
+		{value: "4:05", minute: 245, ok: true},
+		{value: "23:59", minute: 1439, ok: true},
+		{value: "24:00"},
+		{value: "12:60"},
+		{value: "-1:00"},
+		{value: "1200"},
+		{value: "ab:cd"},
+		{value: ""},
+	}
+	for _, tt := range tests {
+		minute, ok := parseClock(tt.value)
+		if minute != tt.minute || ok != tt.ok {
+			t.Errorf("parseClock(%q) = %d, %v, want %d, %v", tt.value, minute, ok, tt.minute, tt.ok)
+		}
+	}
+}
+
+func TestInMaintenanceWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.January, 1, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		start, end string
+		now        time.Time
+		want       bool
+	}{
+		{start: "", end: "", now: at(12, 0), want: true},
+		{start: "04:00", end: "", now: at(12, 0), want: true},
+		{start: "04:00", end: "invalid", now: at(12, 0), want: true},
+		{start: "04:00", end: "06:00", now: at(3, 59), want: false},
+		{start: "04:00", end: "06:00", now: at(4, 0), want: true},
+		{start: "04:00", end: "06:00", now: at(5, 59), want: true},
+		{start: "04:00", end: "06:00", now: at(6, 0), want: false},
+		{start: "23:00", end: "01:00", now: at(22, 59), want: false},
+		{start: "23:00", end: "01:00", now: at(23, 30), want: true},
+		{start: "23:00", end: "01:00", now: at(0, 30), want: true},
+		{start: "23:00", end: "01:00", now: at(1, 0), want: false},
+		{start: "05:00", end: "05:00", now: at(5, 0), want: false},
+	}
+	for _, tt := range tests {
+		if got := inMaintenanceWindow(tt.start, tt.end, tt.now); got != tt.want {
+			t.Errorf("inMaintenanceWindow(%q, %q, %s) = %v, want %v", tt.start, tt.end, tt.now.Format("15:04"), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/FuzzyStatic/blizzard/v3"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type talentReference struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+}
+
+type selectedTalent struct {
+	ID      int `json:"id"`
+	Rank    int `json:"rank"`
+	Tooltip struct {
+		Talent       talentReference `json:"talent"`
+		SpellTooltip struct {
+			Spell talentReference `json:"spell"`
+		} `json:"spell_tooltip"`
+	} `json:"tooltip"`
+}
+
+// characterSpecializations is the specializations profile, the blizzard library predates talent loadouts.
+type characterSpecializations struct {
+	Specializations []struct {
+		Specialization talentReference `json:"specialization"`
+		PvpTalentSlots []struct {
+			Selected struct {
+				Talent talentReference `json:"talent"`
+			} `json:"selected"`
+			SlotNumber int `json:"slot_number"`
+		} `json:"pvp_talent_slots"`
+		Loadouts []struct {
+			IsActive               bool             `json:"is_active"`
+			TalentLoadoutCode      string           `json:"talent_loadout_code"`
+			SelectedClassTalents   []selectedTalent `json:"selected_class_talents"`
+			SelectedSpecTalents    []selectedTalent `json:"selected_spec_talents"`
+			SelectedHeroTalents    []selectedTalent `json:"selected_hero_talents"`
+			SelectedHeroTalentTree talentReference  `json:"selected_hero_talent_tree"`
+		} `json:"loadouts"`
+	} `json:"specializations"`
+	ActiveSpecialization talentReference `json:"active_specialization"`
+}
+
+// talent is a selected talent as stored in the talent fields of "character_talents".
+type talent struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Rank int    `json:"rank"`
+}
+
+func init() {
+	registerCharacterSync(characterSync{
+		name: "specializations",
+		fetch: func(ctx context.Context, client *blizzard.Client, realmSlug, characterName string) (any, error) {
+			path := fmt.Sprintf("/profile/wow/character/%s/%s/specializations", realmSlug, url.PathEscape(strings.ToLower(characterName)))
+			specializations := &characterSpecializations{}
+			if err := getProfileData(ctx, client, path, specializations); err != nil && !errors.Is(err, errNotFound) {
+				return nil, err
+			}
+			return specializations, nil
+		},
+		save: saveTalents,
+	})
+}
+
+func talentList(selected []selectedTalent) []talent {
+	talents := make([]talent, 0, len(selected))
+	for _, t := range selected {
+		name := t.Tooltip.Talent.Name
+		if name == "" {
+			name = t.Tooltip.SpellTooltip.Spell.Name
+		}
+		talents = append(talents, talent{ID: t.ID, Name: name, Rank: t.Rank})
+	}
+	return talents
+}
+
+// saveTalents stores the active loadout of every specialization in "character_talents",
+// a changed loadout code or hero tree is recorded in the character history to see build swaps.
+func saveTalents(app core.App, character *core.Record, data any, runID string) error {
+	specializations := data.(*characterSpecializations)
+
+	rows := make(map[string]map[string]any, len(specializations.Specializations))
+	for _, spec := range specializations.Specializations {
+		pvpTalents := make([]talent, 0, len(spec.PvpTalentSlots))
+		for _, slot := range spec.PvpTalentSlots {
+			pvpTalents = append(pvpTalents, talent{ID: slot.Selected.Talent.ID, Name: slot.Selected.Talent.Name})
+		}
+		row := map[string]any{
+			"spec_name":      spec.Specialization.Name,
+			"active":         spec.Specialization.ID == specializations.ActiveSpecialization.ID,
+			"loadout_code":   "",
+			"hero_tree_id":   0,
+			"hero_tree_name": "",
+			"class_talents":  []talent{},
+			"spec_talents":   []talent{},
+			"hero_talents":   []talent{},
+			"pvp_talents":    pvpTalents,
+		}
+		for _, loadout := range spec.Loadouts {
+			if !loadout.IsActive {
+				continue
+			}
+			row["loadout_code"] = loadout.TalentLoadoutCode
+			row["hero_tree_id"] = loadout.SelectedHeroTalentTree.ID
+			row["hero_tree_name"] = loadout.SelectedHeroTalentTree.Name
+			row["class_talents"] = talentList(loadout.SelectedClassTalents)
+			row["spec_talents"] = talentList(loadout.SelectedSpecTalents)
+			row["hero_talents"] = talentList(loadout.SelectedHeroTalents)
+		}
+		rows[strconv.Itoa(spec.Specialization.ID)] = row
+	}
+	return syncChildRecordsWithHistory(app, "character_talents", character, "spec_id", rows, runID, "loadout_code", "hero_tree_name")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	blizzardHourlyQuota = 36000 // requests per hour and client id
+	quotaThreshold      = 0.9   // share of the hourly quota after which the limiter slows down
+	transportMaxRetries = 4     // retries of a single request on 429 and 5xx responses
+	retryBaseDelay      = 500 * time.Millisecond
+	maxRetryDelay       = time.Minute
+)
+
+type ThrottledTransport struct {
+	roundTripperWrap http.RoundTripper
+	ratelimiter      *rate.Limiter
+	baseLimit        rate.Limit
+
+	mu          sync.Mutex
+	windowStart time.Time
+	windowCount int
+
+	requests  atomic.Int64
+	retries   atomic.Int64
+	throttled atomic.Int64 // nanoseconds spent waiting for the limiter or a retry
+}
+
+// ThrottleStats are the counters of a ThrottledTransport since startup.
+type ThrottleStats struct {
+	Requests      int64   `json:"requests"`
+	Retries       int64   `json:"retries"`
+	ThrottledTime string  `json:"throttled_time"`
+	HourlyCount   int     `json:"hourly_count"`
+	CurrentLimit  float64 `json:"current_limit"`
+}
+
+// RoundTrip honors the rate limit and retries responses with status 429 and 5xx
+// using the Retry-After header or a jittered exponential backoff.
+func (c *ThrottledTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(r.Context()); err != nil {
+			return nil, err
+		}
+
+		req := r
+		if attempt > 0 && r.Body != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = r.Clone(r.Context())
+			req.Body = body
+		}
+
+		resp, err := c.roundTripperWrap.RoundTrip(req)
+		if err != nil || !isRetryableStatus(resp.StatusCode) || attempt >= transportMaxRetries || (r.Body != nil && r.GetBody == nil) {
+			return resp, err
+		}
+
+		delay := retryDelay(resp, attempt)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		c.retries.Add(1)
+		log.Printf("%s %s returned %d, retrying in %s (%d/%d)", r.Method, r.URL.Path, resp.StatusCode, delay.Round(time.Millisecond), attempt+1, transportMaxRetries)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, r.Context().Err()
+		case <-timer.C:
+		}
+		c.throttled.Add(int64(delay))
+	}
+}
+
+// wait blocks until the limiter allows the next request and slows the limiter down
+// when the hourly quota is about to be used up. Only requests the limiter let through are counted.
+func (c *ThrottledTransport) wait(ctx context.Context) error {
+	start := time.Now()
+	err := c.ratelimiter.Wait(ctx) // This is a blocking call. Honors the rate limit
+	c.throttled.Add(int64(time.Since(start)))
+	if err != nil {
+		return err
+	}
+	c.requests.Add(1)
+	c.adaptLimit()
+	return nil
+}
+
+// adaptLimit counts the requests of the current hour. Once the quota threshold is reached
+// the remaining requests are spread over the rest of the hour, the base limit is restored
+// when the next hour starts.
+func (c *ThrottledTransport) adaptLimit() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.windowStart) >= time.Hour {
+		c.windowStart = now
+		c.windowCount = 0
+		if c.ratelimiter.Limit() != c.baseLimit {
+			log.Printf("Hourly API quota window reset, restoring the request rate.")
+			c.ratelimiter.SetLimit(c.baseLimit)
+		}
+	}
+	c.windowCount++
+
+	if c.windowCount < int(blizzardHourlyQuota*quotaThreshold) {
+		return
+	}
+	remaining := max(blizzardHourlyQuota-c.windowCount, 1)
+	left := time.Hour - now.Sub(c.windowStart)
+	limit := min(rate.Limit(float64(remaining)/left.Seconds()), c.baseLimit)
+	if limit < c.ratelimiter.Limit() {
+		if c.ratelimiter.Limit() == c.baseLimit {
+			log.Printf("Hourly API quota almost used up (%d/%d), slowing down to %.2f requests per second.", c.windowCount, blizzardHourlyQuota, float64(limit))
+		}
+		c.ratelimiter.SetLimit(limit)
+	}
+}
+
+// Stats returns the current counters.
+func (c *ThrottledTransport) Stats() ThrottleStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ThrottleStats{
+		Requests:      c.requests.Load(),
+		Retries:       c.retries.Load(),
+		ThrottledTime: time.Duration(c.throttled.Load()).Round(time.Millisecond).String(),
+		HourlyCount:   c.windowCount,
+		CurrentLimit:  float64(c.ratelimiter.Limit()),
+	}
+}
+
+func NewThrottledTransport(limitPeriod time.Duration, requestCount int, transportWrap http.RoundTripper) *ThrottledTransport {
+	return &ThrottledTransport{
+		roundTripperWrap: transportWrap,
+		ratelimiter:      rate.NewLimiter(rate.Every(limitPeriod), requestCount),
+		baseLimit:        rate.Every(limitPeriod),
+	}
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay honors the Retry-After header (seconds or http date) and falls back to
+// an exponential backoff with jitter.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return min(time.Duration(seconds)*time.Second, maxRetryDelay)
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return min(max(time.Until(date), 0), maxRetryDelay)
+		}
+	}
+	backoff := min(retryBaseDelay<<attempt, maxRetryDelay)
+	return backoff/2 + rand.N(backoff/2+1)
+}